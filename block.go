@@ -4,21 +4,24 @@ import (
 	"SpartanGold/utils"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"math/big"
-	"reflect"
+	"sort"
 	"time"
 )
 
 type Block struct {
 	//prevBlockHash  string
-	PrevBlockHash  []byte
-	Target         *big.Int
-	Balances       map[string]int
-	NextNonce      map[string]int
-	Transactions   map[string]*Transaction
+	PrevBlockHash []byte
+	Target        *big.Int
+	Balances      map[string]int
+	NextNonce     map[string]int
+	Transactions  map[string]*Transaction
+	// Pays the coinbase reward and transaction fees to RewardAddr.
+	// Every block but the genesis block has one.
+	Coinbase       *Transaction
 	ChainLength    int
+	TotalWork      *big.Int
 	Timestamp      time.Time
 	RewardAddr     string
 	CoinbaseReward int
@@ -30,6 +33,7 @@ func NewBlock(rewardAddr string, prevBlock *Block, target *big.Int, coinbaseRewa
 	balances := make(map[string]int)
 	nextNonce := make(map[string]int)
 	chainLength := 0
+	totalWork := workForTarget(target)
 	prevBlockHash := []byte{}
 	if prevBlock != nil {
 		prevBlockHash = prevBlock.hashVal()
@@ -40,23 +44,22 @@ func NewBlock(rewardAddr string, prevBlock *Block, target *big.Int, coinbaseRewa
 		for index, val := range prevBlock.NextNonce {
 			nextNonce[index] = val
 		}
-		// Used to determine the winner between competing chains.
-		// Note that this is a little simplistic -- an attacker
-		// could make a long, but low-work chain.  However, this works
-		// well enough for us.
 		chainLength = prevBlock.ChainLength + 1
+		// Used to determine the winner between competing chains.
+		totalWork.Add(totalWork, prevBlock.TotalWork)
 	} else {
 		prevBlockHash = nil
 	}
 
 	transactions := make(map[string]*Transaction)
 	timestamp := time.Now()
-	newBlock := Block{PrevBlockHash: prevBlockHash, Target: target, Balances: balances, NextNonce: nextNonce, Transactions: transactions, ChainLength: chainLength, Timestamp: timestamp, RewardAddr: rewardAddr, CoinbaseReward: coinbaseReward}
+	newBlock := Block{PrevBlockHash: prevBlockHash, Target: target, Balances: balances, NextNonce: nextNonce, Transactions: transactions, ChainLength: chainLength, TotalWork: totalWork, Timestamp: timestamp, RewardAddr: rewardAddr, CoinbaseReward: coinbaseReward}
 
-	if prevBlock != nil && prevBlock.RewardAddr != "" {
-		// Add the previous block's rewards to the miner who found the proof.
-		winnerBalance := newBlock.balanceOf(prevBlock.RewardAddr)
-		newBlock.Balances[prevBlock.RewardAddr] = winnerBalance + prevBlock.totalRewards()
+	if rewardAddr != "" {
+		// The miner is paid by the coinbase transaction, which grows
+		// as transactions add their fees.
+		newBlock.Coinbase = newCoinbaseTransaction(rewardAddr, chainLength, coinbaseReward)
+		newBlock.Balances[rewardAddr] = newBlock.balanceOf(rewardAddr) + coinbaseReward
 	}
 
 	return &newBlock
@@ -71,6 +74,41 @@ func (b Block) isGenesisBlock() bool {
 	return b.ChainLength == 0
 }
 
+/**
+ * The expected number of hashes needed to find a proof for the target,
+ * which is 2^256 / (target + 1).
+ *
+ * @param target - The proof-of-work target of a block.
+ *
+ * @returns {big.Int} - The work represented by a block with the target.
+ */
+func workForTarget(target *big.Int) *big.Int {
+	if target == nil || target.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Div(work, new(big.Int).Add(target, big.NewInt(1)))
+}
+
+/**
+ * Determines whether the chain ending in this block should be preferred
+ * over the chain ending in other.  The chain with more cumulative work wins;
+ * a tie goes to the block with the lower ID, so every node makes the same choice.
+ *
+ * @param {Block} other - The head of the competing chain.
+ *
+ * @returns {Boolean} - True if this block's chain is better.
+ */
+func (b Block) isBetterThan(other *Block) bool {
+	if other == nil {
+		return true
+	}
+	if cmp := b.TotalWork.Cmp(other.TotalWork); cmp != 0 {
+		return cmp > 0
+	}
+	return b.getId() < other.getId()
+}
+
 /**
  * Returns true if the hash of the block is less than the target
  * proof of work value.
@@ -78,6 +116,9 @@ func (b Block) isGenesisBlock() bool {
  * @returns {Boolean} - True if the block has a valid proof.
  */
 func (b Block) hasValidProof() bool {
+	if b.Target == nil {
+		return false
+	}
 	h := string(b.hashVal())
 	n := big.NewInt(0)
 
@@ -90,6 +131,23 @@ func (b Block) hasValidProof() bool {
 	return n.Cmp(b.Target) < 0
 }
 
+/**
+ * The canonical JSON form of a block.  encoding/json writes struct fields in
+ * declaration order and map keys in sorted order, and transactions are listed
+ * with the coinbase transaction first and the rest sorted by ID, so every node
+ * produces the same bytes for the same block.  The reward address and coinbase
+ * reward are not written, since they can be read from the coinbase transaction.
+ */
+type blockJson struct {
+	ChainLength   int            `json:"chainLength"`
+	Timestamp     time.Time      `json:"timestamp"`
+	Target        string         `json:"target"`
+	Balances      map[string]int `json:"balances,omitempty"`
+	PrevBlockHash string         `json:"prevBlockHash,omitempty"`
+	Proof         int            `json:"proof,omitempty"`
+	Transactions  []*Transaction `json:"transactions,omitempty"`
+}
+
 /**
  * Converts a Block into string form.  Some fields are deliberately omitted.
  * Note that Block.deserialize plus block.rerun should restore the block.
@@ -100,45 +158,42 @@ func (b Block) serialize() string {
 	return string(b.toJson())
 }
 
-func (b Block) toJson() []byte { //FIX THIS
-	jsonFile := []byte{}
-	jsonFile = append(jsonFile, '{')
-	properties := make(map[string]bool)
-	properties["ChainLength"] = true
-	properties["Timestamp"] = true
+func (b Block) toJson() []byte {
+	o := blockJson{ChainLength: b.ChainLength, Timestamp: b.Timestamp.UTC(), Target: b.Target.Text(16)}
 	if b.isGenesisBlock() {
 		// The genesis block does not contain a proof or transactions,
 		// but is the only block than can specify balances.
-		properties["Balances"] = true
+		o.Balances = b.Balances
 	} else {
 		// Other blocks must specify transactions and proof details.
-		properties["Proof"] = true
-		properties["Transactions"] = true
-		properties["PrevBlockHash"] = true
-		properties["RewardAddr"] = true
+		o.PrevBlockHash = string(b.PrevBlockHash)
+		o.Proof = b.Proof
+		if b.Coinbase != nil {
+			o.Transactions = append(o.Transactions, b.Coinbase)
+		}
+		for _, id := range b.transactionIds() {
+			o.Transactions = append(o.Transactions, b.Transactions[id])
+		}
 	}
 
-	size := reflect.ValueOf(b).NumField()
-	for i := 0; i < size; i++ {
-		val := reflect.ValueOf(b).Field(i)
-		field := reflect.TypeOf(b).Field(i).Name
-		if marshallField, err := json.Marshal((val).Interface()); err != nil {
-			errors.New("Convert to Json failed.")
-		} else {
-			if properties[field] {
-				jsonFile = append(jsonFile, '"')
-				jsonFile = append(jsonFile, []byte(field)...)
-				jsonFile = append(jsonFile, '"')
-				jsonFile = append(jsonFile, ':')
-				jsonFile = append(jsonFile, (marshallField)...)
-				if i+1 != len(properties) {
-					jsonFile = append(jsonFile, ',')
-				}
-			}
-		}
+	out, err := json.Marshal(&o)
+	if err != nil {
+		panic(err)
 	}
-	jsonFile = append(jsonFile, '}')
-	return jsonFile
+	return out
+}
+
+/**
+ * Returns the IDs of the transactions in the block in sorted order,
+ * so that they are always visited in the same order.
+ */
+func (b Block) transactionIds() []string {
+	ids := make([]string, 0, len(b.Transactions))
+	for id := range b.Transactions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
 }
 
 /**
@@ -168,73 +223,20 @@ func (b Block) getId() string {
  * @param {Transaction} tx - The transaction to add to the block.
  * @param {Client} [client] - A client object, for logging useful messages.
  *
- * @returns {Boolean} - True if the transaction was added successfully.
+ * @returns {error} - nil if the transaction was added successfully; otherwise
+ *    ErrDuplicateTx, ErrInvalidSignature, ErrInsufficientFunds, ErrReplayedTx
+ *    or ErrOutOfOrderTx, wrapped with the ID of the transaction.
  */
-func (b *Block) addTransaction(tx *Transaction, client *Client) bool {
-	msg := NewMsg("", "", "", "")
-
-	if _, found := b.Transactions[tx.getId()]; found {
-		msg.msg = "Duplicate transaction " + tx.getId()
-		if client != nil {
-			client.log(msg)
-		} else { // since I couldn't pull the client for this method, I'll temporarily print it
-			fmt.Println(msg.msg)
-		}
-		return false
-	} else if tx.sig == nil {
-		msg.msg = "Unsigned transaction " + tx.getId()
+func (b *Block) addTransaction(tx *Transaction, client *Client) error {
+	if err := b.checkTransaction(tx); err != nil {
 		if client != nil {
-			client.log(msg)
+			client.log(NewMsg("", err.Error(), "", ""))
 		} else {
-			fmt.Println(msg.msg)
+			fmt.Println(err)
 		}
-		return false
-	} else if !tx.validSignature() {
-		msg.msg = "Invalid signature for transaction " + tx.getId()
-		if client != nil {
-			client.log(msg)
-		} else {
-			fmt.Println(msg.msg)
-		}
-		return false
-	} else if !tx.sufficientFunds(*b) {
-		msg.msg = "Insufficient gold for transaction " + tx.getId()
-		if client != nil {
-			client.log(msg)
-		} else {
-			fmt.Println(msg.msg)
-		}
-		return false
-	}
-
-	// Checking and updating nonce value.
-	// This portion prevents replay attacks.
-	var nonce int
-	if n, found := b.NextNonce[tx.getId()]; found {
-		nonce = n
-	} else {
-		nonce = 0
-	}
-
-	if tx.nonce < nonce {
-		msg.msg = "Replayed transaction " + tx.getId()
-		if client != nil {
-			client.log(msg)
-		} //else {
-		fmt.Printf("Replayed transaction %v \n", tx.getId())
-		//}
-		return false
-	} else if tx.nonce > nonce {
-		msg.msg = "Out of order transaction " + tx.getId()
-		if client != nil {
-			client.log(msg)
-		} //else {
-		fmt.Printf("Out of order transaction %v \n", tx.getId())
-		//}
-		return false
-	} else {
-		b.NextNonce[tx.from] = nonce + 1
+		return err
 	}
+	b.NextNonce[tx.from] = tx.nonce + 1
 
 	// Adding the transaction to the block
 	b.Transactions[tx.getId()] = tx
@@ -249,7 +251,43 @@ func (b *Block) addTransaction(tx *Transaction, client *Client) bool {
 		b.Balances[ad] = b.balanceOf(ad) + gold
 	}
 
-	return true
+	// Paying the fee to the miner through the coinbase transaction.
+	if b.Coinbase != nil {
+		b.Coinbase.outputs[b.RewardAddr] += tx.fee
+		b.Balances[b.RewardAddr] = b.balanceOf(b.RewardAddr) + tx.fee
+	}
+
+	return nil
+}
+
+/**
+ * Determines why a transaction cannot be added to the block, if it cannot.
+ *
+ * @param {Transaction} tx - The transaction to check.
+ *
+ * @returns {error} - nil if the transaction can be added.
+ */
+func (b Block) checkTransaction(tx *Transaction) error {
+	if _, found := b.Transactions[tx.getId()]; found {
+		return fmt.Errorf("%w %v", ErrDuplicateTx, tx.getId())
+	} else if tx.sig == nil {
+		return fmt.Errorf("%w: unsigned transaction %v", ErrInvalidSignature, tx.getId())
+	} else if !tx.validSignature() {
+		return fmt.Errorf("%w for transaction %v", ErrInvalidSignature, tx.getId())
+	} else if !tx.sufficientFunds(b) {
+		return fmt.Errorf("%w for transaction %v", ErrInsufficientFunds, tx.getId())
+	}
+
+	// Checking the nonce value, which is tracked per sender.
+	// This portion prevents replay attacks.
+	nonce := b.NextNonce[tx.from]
+
+	if tx.nonce < nonce {
+		return fmt.Errorf("%w %v", ErrReplayedTx, tx.getId())
+	} else if tx.nonce > nonce {
+		return fmt.Errorf("%w %v", ErrOutOfOrderTx, tx.getId())
+	}
+	return nil
 }
 
 /**
@@ -261,15 +299,17 @@ func (b *Block) addTransaction(tx *Transaction, client *Client) bool {
  *
  * @param {Block} prevBlock - The previous block in the blockchain, used for initial balances.
  *
- * @returns {Boolean} - True if the block's transactions are all valid.
+ * @returns {error} - nil if the block's transactions are all valid, or the
+ *    reason the first invalid transaction was rejected.
  */
-func (b *Block) rerun(prevBlock *Block) bool {
+func (b *Block) rerun(prevBlock *Block) error {
 	// Setting balances to the previous block's balances.
 	b.Balances = make(map[string]int)
 	b.NextNonce = make(map[string]int)
 
 	// Re-adding all transactions.
 	txs := b.Transactions
+	ids := b.transactionIds()
 	b.Transactions = make(map[string]*Transaction)
 
 	for ad, value := range prevBlock.Balances {
@@ -279,27 +319,47 @@ func (b *Block) rerun(prevBlock *Block) bool {
 		b.NextNonce[ad] = value
 	}
 
-	// Adding coinbase reward for prevBlock.
-	winnerBalance := b.balanceOf(prevBlock.RewardAddr)
-	if prevBlock.RewardAddr != "" {
-		b.Balances[prevBlock.RewardAddr] = winnerBalance + prevBlock.totalRewards()
+	b.TotalWork = new(big.Int).Add(prevBlock.TotalWork, workForTarget(b.Target))
+
+	// Paying the coinbase reward.  The fees are added back to the
+	// coinbase transaction as the transactions are re-added.
+	b.Coinbase = nil
+	if b.RewardAddr != "" {
+		b.Coinbase = newCoinbaseTransaction(b.RewardAddr, b.ChainLength, b.CoinbaseReward)
+		b.Balances[b.RewardAddr] = b.balanceOf(b.RewardAddr) + b.CoinbaseReward
 	}
 
-	for _, value := range txs {
-		success := b.addTransaction(value, nil) //not sure how to pull the client for addTransaction method
-		if !success {
-			fmt.Printf("Transaction %v failed.\n", value.getId())
-			return false
+	// A block does not record the order its transactions were added in, so
+	// they are added in passes: each pass adds every transaction that is valid
+	// so far.  Adding a transaction can only hold up later transactions from the
+	// same sender, so this succeeds whenever some order of the transactions does.
+	pending := []*Transaction{}
+	for _, id := range ids {
+		pending = append(pending, txs[id])
+	}
+	for len(pending) > 0 {
+		remaining := []*Transaction{}
+		var err error
+		for _, tx := range pending {
+			if err = b.checkTransaction(tx); err != nil {
+				remaining = append(remaining, tx)
+				continue
+			}
+			b.addTransaction(tx, nil) //not sure how to pull the client for addTransaction method
+		}
+		if len(remaining) == len(pending) {
+			return err
 		}
+		pending = remaining
 	}
 
-	return true
+	return nil
 }
 
 /**
  * The total amount of gold paid to the miner who produced this block,
- * if the block is accepted.  This includes both the coinbase transaction
- * and any transaction fees.
+ * if the block is accepted.  This includes both the coinbase reward
+ * and any transaction fees, and is the output of the coinbase transaction.
  *
  * @returns {Number} Total reward in gold for the user.
  *
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+/**
+ * A BlockStore holds every block a client has accepted.  Blocks are always
+ * stored after their parent, so the stored order can be used to replay the
+ * blockchain.
+ */
+type BlockStore interface {
+	/**
+	 * Returns the block with the specified ID, or nil if it is not stored.
+	 */
+	get(id string) *Block
+
+	/**
+	 * Stores a block.  Storing a block that is already stored has no effect.
+	 */
+	put(block *Block) error
+
+	/**
+	 * Returns the IDs of every stored block, in the order they were stored.
+	 */
+	ids() []string
+}
+
+/**
+ * A BlockStore that only keeps blocks in memory, so they are lost
+ * when the process exits.
+ */
+type memoryBlockStore struct {
+	blocks map[string]*Block
+	order  []string
+	mu     sync.RWMutex
+}
+
+func NewMemoryBlockStore() *memoryBlockStore {
+	var s memoryBlockStore
+	s.blocks = make(map[string]*Block)
+	s.order = []string{}
+	return &s
+}
+
+func (s *memoryBlockStore) get(id string) *Block {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.blocks[id]
+}
+
+func (s *memoryBlockStore) put(block *Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := block.getId()
+	if _, ok := s.blocks[id]; !ok {
+		s.blocks[id] = block
+		s.order = append(s.order, id)
+	}
+	return nil
+}
+
+func (s *memoryBlockStore) ids() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string{}, s.order...)
+}
+
+/**
+ * The location of a block in a fileBlockStore's log.
+ */
+type logEntry struct {
+	offset int64
+	size   int
+}
+
+/**
+ * A BlockStore backed by an append-only log file.  Each line of the log
+ * holds a block ID, a tab, and the serialized block.  The log is indexed
+ * by block ID when the store is opened; blocks are only deserialized
+ * (and rerun against their parent) when they are first read, and are
+ * kept in memory after that.
+ */
+type fileBlockStore struct {
+	file       *os.File
+	blockChain *BlockChain
+	index      map[string]logEntry
+	order      []string
+	size       int64
+	cache      map[string]*Block
+	mu         sync.Mutex
+}
+
+/**
+ * Opens the block log at path, creating it if it does not exist.
+ * A partly written block at the end of the log, left behind if the
+ * process stopped while writing it, is discarded.
+ *
+ * @param path - The location of the log file.
+ * @param bc - The blockchain settings, used to deserialize stored blocks.
+ */
+func NewFileBlockStore(path string, bc *BlockChain) (*fileBlockStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	var s fileBlockStore
+	s.file = file
+	s.blockChain = bc
+	s.index = make(map[string]logEntry)
+	s.order = []string{}
+	s.cache = make(map[string]*Block)
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			file.Close()
+			return nil, err
+		}
+		tab := bytes.IndexByte(line, '\t')
+		if tab < 0 {
+			file.Close()
+			return nil, fmt.Errorf("malformed block log %v at offset %v", path, s.size)
+		}
+		id := string(line[:tab])
+		if _, ok := s.index[id]; !ok {
+			s.index[id] = logEntry{s.size + int64(tab) + 1, len(line) - tab - 2}
+			s.order = append(s.order, id)
+		}
+		s.size += int64(len(line))
+	}
+
+	if err := file.Truncate(s.size); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *fileBlockStore) get(id string) *Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+/**
+ * Returns a stored block, reading it from the log if it has not been
+ * read yet.  The caller must hold s.mu.
+ */
+func (s *fileBlockStore) load(id string) *Block {
+	if block, ok := s.cache[id]; ok {
+		return block
+	}
+	entry, ok := s.index[id]
+	if !ok {
+		return nil
+	}
+
+	data := make([]byte, entry.size)
+	if _, err := s.file.ReadAt(data, entry.offset); err != nil {
+		fmt.Printf("Could not read block %v: %v\n", id, err)
+		return nil
+	}
+	block := s.blockChain.deserializeBlock(data)
+	if block == nil {
+		return nil
+	}
+	if !block.isGenesisBlock() {
+		// Balances are not stored, so they are restored from the parent.
+		prevBlock := s.load(string(block.PrevBlockHash))
+		if prevBlock == nil {
+			fmt.Printf("Could not restore block %v: %v\n", id, ErrMissingParent)
+			return nil
+		}
+		if err := block.rerun(prevBlock); err != nil {
+			fmt.Printf("Could not restore block %v: %v\n", id, err)
+			return nil
+		}
+	}
+	s.cache[id] = block
+	return block
+}
+
+func (s *fileBlockStore) put(block *Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := block.getId()
+	if _, ok := s.index[id]; ok {
+		return nil
+	}
+
+	data := block.toJson()
+	line := make([]byte, 0, len(id)+len(data)+2)
+	line = append(line, id...)
+	line = append(line, '\t')
+	line = append(line, data...)
+	line = append(line, '\n')
+	if _, err := s.file.WriteAt(line, s.size); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	s.index[id] = logEntry{s.size + int64(len(id)) + 1, len(data)}
+	s.order = append(s.order, id)
+	s.size += int64(len(line))
+	s.cache[id] = block
+	return nil
+}
+
+func (s *fileBlockStore) ids() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.order...)
+}
+
+/**
+ * Closes the log file.
+ */
+func (s *fileBlockStore) close() error {
+	return s.file.Close()
+}
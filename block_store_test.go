@@ -0,0 +1,123 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/**
+ * Opens a block log, failing the test if it cannot be opened.
+ */
+func openBlockStore(t *testing.T, path string, bc *BlockChain) *fileBlockStore {
+	t.Helper()
+	store, err := NewFileBlockStore(path, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestFileBlockStoreRestoresTheChain(t *testing.T) {
+	bc := testBlockChain(t)
+	key := utils.GenerateKeypair()
+	g := fundedGenesis(t, bc, key)
+	path := filepath.Join(t.TempDir(), "blocks.log")
+
+	store := openBlockStore(t, path, bc)
+	m, err := NewMinerWithStore("Miner", NewFakeNet(), bc, g, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.addTransaction(signedPayment(key, 0, "payee", 10))
+	for i := 0; i < bc.cfg.confirmedDepth+2; i++ {
+		mineBlock(t, m)
+	}
+	store.close()
+
+	// The balances are not stored, so they only come back if
+	// every block is rerun against its parent.
+	store = openBlockStore(t, path, bc)
+	defer store.close()
+	c, err := NewClientWithStore("Restarted", NewFakeNet(), bc, g, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.lastBlock.getId() != m.MClient.lastBlock.getId() {
+		t.Fatalf("head is at height %v after reloading, want %v", c.lastBlock.ChainLength, m.MClient.lastBlock.ChainLength)
+	}
+	if c.lastConfirmedBlock.getId() != m.MClient.lastConfirmedBlock.getId() {
+		t.Fatalf("last confirmed block is at height %v after reloading, want %v", c.lastConfirmedBlock.ChainLength, m.MClient.lastConfirmedBlock.ChainLength)
+	}
+	for _, address := range []string{utils.CalcAddress(key.Public()), "payee", m.MClient.address} {
+		if got, want := c.lastBlock.balanceOf(address), m.MClient.lastBlock.balanceOf(address); got != want {
+			t.Fatalf("%v has %v gold after reloading, want %v", address, got, want)
+		}
+	}
+}
+
+func TestFileBlockStoreDiscardsPartlyWrittenBlock(t *testing.T) {
+	bc := testBlockChain(t)
+	g := fundedGenesis(t, bc)
+	b1 := solve(bc.makeBlock("miner", g, nil, nil))
+	path := filepath.Join(t.TempDir(), "blocks.log")
+
+	store := openBlockStore(t, path, bc)
+	for _, block := range []*Block{g, b1} {
+		if err := store.put(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.close()
+
+	// The process stopped halfway through writing the next block.
+	b2 := solve(bc.makeBlock("miner", b1, nil, nil))
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := b2.toJson()
+	if _, err := file.Write(append([]byte(b2.getId()+"\t"), data[:len(data)/2]...)); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	store = openBlockStore(t, path, bc)
+	if ids := store.ids(); len(ids) != 2 || ids[0] != g.getId() || ids[1] != b1.getId() {
+		t.Fatalf("store holds %v, want only the two complete blocks", ids)
+	}
+	if store.get(b2.getId()) != nil {
+		t.Fatal("partly written block was read back")
+	}
+	// The block is written again after the truncated log.
+	if err := store.put(b2); err != nil {
+		t.Fatal(err)
+	}
+	store.close()
+
+	store = openBlockStore(t, path, bc)
+	defer store.close()
+	if ids := store.ids(); len(ids) != 3 {
+		t.Fatalf("store holds %v blocks, want 3", len(ids))
+	}
+	if block := store.get(b2.getId()); block == nil || block.getId() != b2.getId() {
+		t.Fatal("could not read back the block written after truncating the log")
+	}
+}
+
+func TestClientRefusesStoreOfAnotherChain(t *testing.T) {
+	bc := testBlockChain(t)
+	g := fundedGenesis(t, bc)
+	store := NewMemoryBlockStore()
+	store.put(g)
+
+	other := fundedGenesis(t, bc, utils.GenerateKeypair())
+	if _, err := NewClientWithStore("C", NewFakeNet(), bc, other, store, nil); !errors.Is(err, ErrWrongGenesis) {
+		t.Fatalf("got %v, want ErrWrongGenesis", err)
+	}
+	if _, err := NewClientWithStore("C", NewFakeNet(), bc, g, store, nil); err != nil {
+		t.Fatalf("store of the same chain refused: %v", err)
+	}
+}
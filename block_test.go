@@ -0,0 +1,39 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"errors"
+	"testing"
+)
+
+func TestAddTransactionRefusesReplayedTransaction(t *testing.T) {
+	bc := testBlockChain(t)
+	key := utils.GenerateKeypair()
+	g := fundedGenesis(t, bc, key)
+
+	tx := signedPayment(key, 0, "payee", 10)
+	first := bc.makeBlock("miner", g, nil, nil)
+	if err := first.addTransaction(tx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The sender can still afford it, but its nonce has been used.
+	next := bc.makeBlock("miner", first, nil, nil)
+	if err := next.addTransaction(tx, nil); !errors.Is(err, ErrReplayedTx) {
+		t.Fatalf("got %v, want ErrReplayedTx", err)
+	}
+	if balance := next.balanceOf("payee"); balance != 10 {
+		t.Fatalf("payee has %v gold after the replay, want 10", balance)
+	}
+}
+
+func TestAddTransactionRefusesNonceFromTheFuture(t *testing.T) {
+	bc := testBlockChain(t)
+	key := utils.GenerateKeypair()
+	g := fundedGenesis(t, bc, key)
+
+	b := bc.makeBlock("miner", g, nil, nil)
+	if err := b.addTransaction(signedPayment(key, 1, "payee", 10), nil); !errors.Is(err, ErrOutOfOrderTx) {
+		t.Fatalf("got %v, want ErrOutOfOrderTx", err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Reasons that a block may be rejected by Client.validateBlock.
+type BlockRejectionReason int
+
+const (
+	REJECT_INVALID_PROOF BlockRejectionReason = iota + 1
+	REJECT_WRONG_TARGET
+	REJECT_WRONG_COINBASE_REWARD
+	REJECT_TIMESTAMP_TOO_EARLY
+	REJECT_TIMESTAMP_TOO_LATE
+	REJECT_WRONG_CHAIN_LENGTH
+	REJECT_TOO_MANY_TRANSACTIONS
+	REJECT_BLOCK_TOO_LARGE
+	REJECT_INVALID_COINBASE
+)
+
+func (r BlockRejectionReason) String() string {
+	switch r {
+	case REJECT_INVALID_PROOF:
+		return "invalid proof"
+	case REJECT_WRONG_TARGET:
+		return "wrong target"
+	case REJECT_WRONG_COINBASE_REWARD:
+		return "wrong coinbase reward"
+	case REJECT_TIMESTAMP_TOO_EARLY:
+		return "timestamp too early"
+	case REJECT_TIMESTAMP_TOO_LATE:
+		return "timestamp too late"
+	case REJECT_WRONG_CHAIN_LENGTH:
+		return "wrong chain length"
+	case REJECT_TOO_MANY_TRANSACTIONS:
+		return "too many transactions"
+	case REJECT_BLOCK_TOO_LARGE:
+		return "block too large"
+	case REJECT_INVALID_COINBASE:
+		return "invalid coinbase transaction"
+	}
+	return fmt.Sprintf("unknown reason %d", int(r))
+}
+
+/**
+ * The error returned when a block breaks one of the block validation rules.
+ */
+type BlockValidationError struct {
+	Reason  BlockRejectionReason
+	BlockId string
+	Detail  string
+}
+
+func (e *BlockValidationError) Error() string {
+	return fmt.Sprintf("block %v rejected (%v): %v", e.BlockId, e.Reason, e.Detail)
+}
+
+/**
+ * Lets errors.Is(err, ErrInvalidProof) recognize a rejected proof.
+ */
+func (e *BlockValidationError) Unwrap() error {
+	if e.Reason == REJECT_INVALID_PROOF {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+/**
+ * Checks a block against every rule that can be checked without rerunning
+ * its transactions: the proof of work, the target required by the difficulty
+ * adjustment rule, the coinbase transaction and reward, the timestamp, the chain length, and
+ * the limits on the number of transactions and the size of the block.
+ *
+ * @param {Block} block - The block to check.  It must not be the genesis block.
+ * @param {Block} prevBlock - The parent of the block.
+ *
+ * @returns {error} - A *BlockValidationError, or nil if the block is valid.
+ */
+func (c *Client) validateBlock(block *Block, prevBlock *Block) error {
+	cfg := c.blockChain.cfg
+	reject := func(reason BlockRejectionReason, format string, args ...interface{}) error {
+		return &BlockValidationError{reason, block.getId(), fmt.Sprintf(format, args...)}
+	}
+
+	if !block.hasValidProof() {
+		return reject(REJECT_INVALID_PROOF, "hash is not below the target")
+	}
+
+	// The target is part of the block, so it has to be checked against
+	// the difficulty adjustment rule as well as the proof.
+	if expected := c.blockChain.expectedTarget(prevBlock, c.chain); block.Target.Cmp(expected) != 0 {
+		return reject(REJECT_WRONG_TARGET, "expected target %x, got %x", expected, block.Target)
+	}
+
+	// The coinbase transaction must pay exactly the reward plus the fees
+	// to the reward address, so it must match the one the block would make.
+	if block.Coinbase == nil {
+		return reject(REJECT_INVALID_COINBASE, "missing coinbase transaction")
+	}
+	expectedCoinbase := newCoinbaseTransaction(block.RewardAddr, block.ChainLength, block.totalRewards())
+	if block.RewardAddr == "" || block.Coinbase.sig != nil || block.Coinbase.getId() != expectedCoinbase.getId() {
+		return reject(REJECT_INVALID_COINBASE, "coinbase transaction %v is not well formed", block.Coinbase.getId())
+	}
+	if reward := c.blockChain.rewardAt(block.ChainLength); block.CoinbaseReward != reward {
+		return reject(REJECT_WRONG_COINBASE_REWARD, "expected %v, got %v", reward, block.CoinbaseReward)
+	}
+
+	if median := c.medianTimePast(prevBlock); !block.Timestamp.After(median) {
+		return reject(REJECT_TIMESTAMP_TOO_EARLY, "%v is not after the median of recent blocks, %v", block.Timestamp.UTC(), median.UTC())
+	}
+	if latest := time.Now().Add(MAX_FUTURE_BLOCK_TIME); block.Timestamp.After(latest) {
+		return reject(REJECT_TIMESTAMP_TOO_LATE, "%v is after %v", block.Timestamp.UTC(), latest.UTC())
+	}
+
+	if block.ChainLength != prevBlock.ChainLength+1 {
+		return reject(REJECT_WRONG_CHAIN_LENGTH, "expected %v, got %v", prevBlock.ChainLength+1, block.ChainLength)
+	}
+
+	if len(block.Transactions) > cfg.maxBlockTransactions {
+		return reject(REJECT_TOO_MANY_TRANSACTIONS, "%v transactions, but at most %v are allowed", len(block.Transactions), cfg.maxBlockTransactions)
+	}
+	if size := len(block.toJson()); size > cfg.maxBlockSize {
+		return reject(REJECT_BLOCK_TOO_LARGE, "%v bytes, but at most %v are allowed", size, cfg.maxBlockSize)
+	}
+
+	return nil
+}
+
+/**
+ * Returns the median timestamp of the last MEDIAN_TIME_SPAN blocks ending in
+ * block.  A new block's timestamp must be after it, which keeps timestamps
+ * moving forward even though individual miners' clocks may disagree.
+ *
+ * @param {Block} block - The most recent block to include.
+ */
+func (c *Client) medianTimePast(block *Block) time.Time {
+	times := []time.Time{}
+	for block != nil && len(times) < MEDIAN_TIME_SPAN {
+		times = append(times, block.Timestamp)
+		block = c.blocks.get(string(block.PrevBlockHash))
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times[len(times)/2]
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestValidateBlock(t *testing.T) {
+	tests := []struct {
+		name string
+		// 0 if the block should be accepted.
+		reason BlockRejectionReason
+		// Changes the settings of the blockchain.
+		limit func(cfg *Cfg)
+		// Changes the block before its proof is found.
+		change func(b *Block, g *Block)
+	}{
+		{name: "valid block"},
+		{name: "hash above target", reason: REJECT_INVALID_PROOF},
+		{
+			name:   "target easier than expected",
+			reason: REJECT_WRONG_TARGET,
+			change: func(b *Block, g *Block) { b.Target = new(big.Int).Lsh(b.Target, 1) },
+		},
+		{
+			name:   "no coinbase transaction",
+			reason: REJECT_INVALID_COINBASE,
+			change: func(b *Block, g *Block) { b.Coinbase = nil },
+		},
+		{
+			name:   "coinbase pays more than the reward and fees",
+			reason: REJECT_INVALID_COINBASE,
+			change: func(b *Block, g *Block) { b.Coinbase.outputs[b.RewardAddr]++ },
+		},
+		{
+			name:   "coinbase reward too high",
+			reason: REJECT_WRONG_COINBASE_REWARD,
+			change: func(b *Block, g *Block) {
+				b.CoinbaseReward++
+				b.Coinbase = newCoinbaseTransaction(b.RewardAddr, b.ChainLength, b.totalRewards())
+			},
+		},
+		{
+			name:   "timestamp not after the median of recent blocks",
+			reason: REJECT_TIMESTAMP_TOO_EARLY,
+			change: func(b *Block, g *Block) { b.Timestamp = g.Timestamp },
+		},
+		{
+			name:   "timestamp too far in the future",
+			reason: REJECT_TIMESTAMP_TOO_LATE,
+			change: func(b *Block, g *Block) { b.Timestamp = time.Now().Add(MAX_FUTURE_BLOCK_TIME + time.Hour) },
+		},
+		{
+			name:   "chain length skips a height",
+			reason: REJECT_WRONG_CHAIN_LENGTH,
+			change: func(b *Block, g *Block) {
+				b.ChainLength++
+				b.Coinbase = newCoinbaseTransaction(b.RewardAddr, b.ChainLength, b.totalRewards())
+			},
+		},
+		{
+			name:   "too many transactions",
+			reason: REJECT_TOO_MANY_TRANSACTIONS,
+			limit:  func(cfg *Cfg) { cfg.maxBlockTransactions = 1 },
+		},
+		{
+			name:   "block too large",
+			reason: REJECT_BLOCK_TOO_LARGE,
+			limit:  func(cfg *Cfg) { cfg.maxBlockSize = 100 },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bc := testBlockChain(t)
+			if test.limit != nil {
+				test.limit(&bc.cfg)
+			}
+			key := utils.GenerateKeypair()
+			g := fundedGenesis(t, bc, key)
+			c := NewClient("C", NewFakeNet(), bc, g)
+
+			b := bc.makeBlock("miner", g, nil, nil)
+			for nonce := 0; nonce < 2; nonce++ {
+				if err := b.addTransaction(signedPayment(key, nonce, "payee", 10), nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.change != nil {
+				test.change(b, g)
+			}
+			solve(b)
+			if test.reason == REJECT_INVALID_PROOF {
+				for b.hasValidProof() {
+					b.Proof++
+				}
+			}
+
+			err := c.validateBlock(b, g)
+			if test.reason == 0 {
+				if err != nil {
+					t.Fatalf("valid block refused: %v", err)
+				}
+				return
+			}
+			var rejection *BlockValidationError
+			if !errors.As(err, &rejection) {
+				t.Fatalf("got %v, want a rejection for %v", err, test.reason)
+			}
+			if rejection.Reason != test.reason {
+				t.Fatalf("rejected for %v, want %v", rejection.Reason, test.reason)
+			}
+		})
+	}
+}
+
+func TestReceiveBlockRefusesAnotherGenesisBlock(t *testing.T) {
+	bc := testBlockChain(t)
+	g := fundedGenesis(t, bc)
+	c := NewClient("C", NewFakeNet(), bc, g)
+
+	// A target of 0 claims more work than any real chain could have.
+	forged := NewBlock("", nil, big.NewInt(0), 0)
+	forged.Balances["attacker"] = 1000000
+
+	_, err := c.receiveBlock(forged)
+	var rejection *BlockValidationError
+	if !errors.As(err, &rejection) || rejection.Reason != REJECT_WRONG_CHAIN_LENGTH {
+		t.Fatalf("got %v, want a rejection for %v", err, REJECT_WRONG_CHAIN_LENGTH)
+	}
+	if c.lastBlock != g || c.lastConfirmedBlock != g {
+		t.Fatal("forged genesis block replaced the client's chain")
+	}
+}
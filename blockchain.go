@@ -1,9 +1,10 @@
 package main
 
 import (
-	"errors"
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"time"
 )
 
 // Network message constants
@@ -19,14 +20,45 @@ const START_MINING = "START_MINING"
 const NUM_ROUNDS_MINING = 2000
 
 // Constants related to proof-of-work target
-//const POW_BASE_TARGET = new BigInteger("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", 16);
-//const POW_BASE_TARGET, valid = new(big.Int).SetString("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", 16);
+// const POW_BASE_TARGET = new BigInteger("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", 16);
+// const POW_BASE_TARGET, valid = new(big.Int).SetString("ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", 16);
 const POW_BASE_TARGET = "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff" //64
 const POW_LEADING_ZEROES = 15
 
-// Constants for mining rewards and default transaction fees
+// Constants for difficulty adjustment.  Every RETARGET_INTERVAL blocks, the
+// target is adjusted so that blocks are found every TARGET_BLOCK_INTERVAL,
+// changing by at most a factor of MAX_RETARGET_FACTOR at a time.
+const RETARGET_INTERVAL = 10
+
+const TARGET_BLOCK_INTERVAL = 1 * time.Second
+
+const MAX_RETARGET_FACTOR = 4
+
+// Constants for block validation.  A block's timestamp must be after the
+// median of the last MEDIAN_TIME_SPAN blocks, and no more than
+// MAX_FUTURE_BLOCK_TIME ahead of the receiving client's clock.
+const MEDIAN_TIME_SPAN = 11
+
+const MAX_FUTURE_BLOCK_TIME = 2 * time.Hour
+
+// Limits on the contents of a block.  MAX_BLOCK_SIZE is in bytes of the serialized block.
+const MAX_BLOCK_TRANSACTIONS = 1000
+
+const MAX_BLOCK_SIZE = 1 << 20
+
+// The most transactions a miner keeps waiting in its mempool.
+const MEMPOOL_MAX_TRANSACTIONS = 5000
+
+// Constants for mining rewards and default transaction fees.  The coinbase
+// reward starts at COINBASE_AMT_ALLOWED and halves every HALVING_INTERVAL
+// blocks.  If MAX_SUPPLY is positive, no more gold is mined once that much
+// has been paid out in coinbase rewards.
 const COINBASE_AMT_ALLOWED = 25
 
+const HALVING_INTERVAL = 210000
+
+const MAX_SUPPLY = 0
+
 const DEFAULT_TX_FEE = 1
 
 // If a block is 6 blocks older than the current block, it is considered
@@ -62,23 +94,51 @@ func GET_CONFIRMED_DEPTH(b BlockChain) int      { return b.cfg.confirmedDepth }
 
 type BlockChain struct {
 	cfg Cfg
+	// Identifies the blockchain to peers; set along with the genesis block.
+	chainId string
 }
 
 type Cfg struct {
 	coinbaseAmount int
-	defaultTxFee   int
-	confirmedDepth int
-	powTarget      *big.Int
+	// Number of blocks between halvings of the coinbase reward; 0 disables them.
+	halvingInterval int
+	// Most gold paid out in coinbase rewards; 0 means there is no limit.
+	maxSupply        int
+	defaultTxFee     int
+	confirmedDepth   int
+	powLeadingZeroes int
+	// Derived from powLeadingZeroes by NewBlockChain and parseCfg.
+	powTarget *big.Int
+	// Number of proofs a miner tries before checking for messages.
+	miningRounds int
+	// Number of blocks between difficulty adjustments; 0 disables them.
+	retargetInterval  int
+	blockInterval     time.Duration
+	maxRetargetFactor int64
+	// Limits on the contents of a block.
+	maxBlockTransactions int
+	maxBlockSize         int
 }
 
-/*
-func NewBlockChain() BlockChain {
-	var cfg Cfg
+/**
+ * Creates a blockchain with the specified settings.
+ *
+ * @param cfg - Settings for the blockchain, e.g. from DefaultCfg or LoadCfg.
+ *
+ * @returns {BlockChain} - The blockchain, or ErrInvalidConfig if cfg is not valid.
+ */
+func NewBlockChain(cfg Cfg) (*BlockChain, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 	var bc BlockChain
 	bc.cfg = cfg
-	return bc
+	// Never trusting the field, so that the target always matches
+	// the powLeadingZeroes that the chain ID is computed from.
+	bc.cfg.powTarget = powTargetFor(cfg.powLeadingZeroes)
+	return &bc, nil
 }
-*/
+
 /**
  * Produces a new genesis block, giving the specified clients
  * the specified amount of starting gold.  Either clientBalanceMap
@@ -88,40 +148,30 @@ func NewBlockChain() BlockChain {
  * set the genesis block for every client passed in.  This option
  * is useful in single-threaded mode.
  *
- * @param {Object} cfg - Settings for the blockchain.
- * @param {Class} cfg.blockClass - Implementation of the Block class.
- * @param {Class} cfg.transactionClass - Implementation of the Transaction class.
- * @param {Map} [cfg.clientBalanceMap] - Mapping of clients to their starting balances.
- * @param {Object} [cfg.startingBalances] - Mapping of client addresses to their starting balances.
- * @param {number} [cfg.powLeadingZeroes] - Number of leading zeroes required for a valid proof-of-work.
- * @param {number} [cfg.coinbaseAmount] - Amount of gold awarded to a miner for creating a block.
- * @param {number} [cfg.defaultTxFee] - Amount of gold awarded to a miner for accepting a transaction,
- *    if not overridden by the client.
- * @param {number} [cfg.confirmedDepth] - Number of blocks required after a block before it is
- *    considered confirmed.
+ * @param {Map} [clientBalanceMap] - Mapping of clients to their starting balances.
+ * @param {Object} [startingBalances] - Mapping of client addresses to their starting balances.
  *
- * @returns {Block} - The genesis block.
+ * @returns {Block} - The genesis block, or ErrInvalidConfig if both
+ *    clientBalanceMap and startingBalances are set, or if the
+ *    blockchain's settings are not valid.
  */
-func (b *BlockChain) makeGenesis(clientBalanceMap map[*Client]int, startingBalances map[string]int) *Block {
+func (b *BlockChain) makeGenesis(clientBalanceMap map[*Client]int, startingBalances map[string]int) (*Block, error) {
+	return b.makeGenesisAt(clientBalanceMap, startingBalances, time.Now())
+}
+
+/**
+ * Produces a new genesis block with the specified timestamp, as for
+ * makeGenesis.  Nodes that use the same balances, timestamp and
+ * settings produce the same genesis block, and so the same chain ID.
+ */
+func (b *BlockChain) makeGenesisAt(clientBalanceMap map[*Client]int, startingBalances map[string]int, timestamp time.Time) (*Block, error) {
 
 	if clientBalanceMap != nil && startingBalances != nil {
-		errors.New("You may set clientBalanceMap OR set startingBalances, but not both.")
+		return nil, fmt.Errorf("%w: you may set clientBalanceMap OR set startingBalances, but not both", ErrInvalidConfig)
 	}
-
-	// Setting blockchain configuration
-	b.cfg.coinbaseAmount = COINBASE_AMT_ALLOWED
-	fmt.Println(b.cfg.coinbaseAmount)
-	b.cfg.defaultTxFee = DEFAULT_TX_FEE
-	b.cfg.confirmedDepth = CONFIRMED_DEPTH
-	
-	powT := new(big.Int)
-	powT, valid := powT.SetString(POW_BASE_TARGET, 16)
-	if valid {
-		powT.Rsh(powT, uint(POW_LEADING_ZEROES)) //rightshift
+	if err := b.cfg.validate(); err != nil {
+		return nil, err
 	}
-	b.cfg.powTarget = powT
-	fmt.Println(b.cfg.powTarget)
-	fmt.Println(&b.cfg.powTarget)
 
 	// If startingBalances was specified, we initialize our balances to that object.
 	balances := make(map[string]int) //empty
@@ -136,34 +186,150 @@ func (b *BlockChain) makeGenesis(clientBalanceMap map[*Client]int, startingBalan
 		}
 	}
 
-	g := b.makeBlock("", nil, b.cfg.powTarget, &b.cfg.coinbaseAmount)
+	g := b.makeBlock("", nil, b.cfg.powTarget, nil)
+	g.Timestamp = timestamp
 	// Initializing starting balances in the genesis block.
 	for address, balance := range balances {
 		g.Balances[address] = balance
 	}
+	b.chainId = calcChainId(g, b.cfg)
 
 	// If clientBalanceMap was specified, we set the genesis block for every client.
 	if clientBalanceMap != nil {
 		for client, _ := range clientBalanceMap {
-			client.setGenesisBlock(g)
 			client.blockChain = b
+			client.setGenesisBlock(g)
 		}
 	}
-	return g
+	return g, nil
+}
+
+/**
+ * Returns the easiest possible proof-of-work target.
+ */
+func powBaseTarget() *big.Int {
+	target, _ := new(big.Int).SetString(POW_BASE_TARGET, 16)
+	return target
+}
+
+/**
+ * Determines the proof-of-work target for the block following prevBlock.
+ * Every cfg.retargetInterval blocks, the target is scaled by how long the
+ * last cfg.retargetInterval blocks took compared to cfg.blockInterval per
+ * block, changing by at most cfg.maxRetargetFactor either way.  Between
+ * adjustments, a block uses the same target as its parent.
+ *
+ * The first adjustment waits until the window no longer includes the
+ * genesis block, whose timestamp is when the chain was created rather
+ * than when mining started.
+ *
+ * @param prevBlock - The parent of the block.
+ * @param chain - Used to look up the ancestors of prevBlock.
+ *
+ * @returns {big.Int} - The target that the block must use.
+ */
+func (bc BlockChain) expectedTarget(prevBlock *Block, chain *chainIndex) *big.Int {
+	if prevBlock == nil {
+		return bc.cfg.powTarget
+	}
+	n := bc.cfg.retargetInterval
+	height := prevBlock.ChainLength + 1
+	if n <= 0 || height%n != 0 || height-n-1 < 1 {
+		return prevBlock.Target
+	}
+
+	first := chain.ancestor(prevBlock, prevBlock.ChainLength-n)
+	if first == nil {
+		return prevBlock.Target
+	}
+
+	factor := bc.cfg.maxRetargetFactor
+	if factor < 1 {
+		factor = 1
+	}
+	expected := int64(n) * int64(bc.cfg.blockInterval)
+	// Only the wall clock readings are used, since those are all that
+	// other nodes see once the blocks have been serialized.
+	actual := prevBlock.Timestamp.UnixNano() - first.Timestamp.UnixNano()
+	if actual < expected/factor {
+		actual = expected / factor
+	} else if actual > expected*factor {
+		actual = expected * factor
+	}
+
+	target := new(big.Int).Mul(prevBlock.Target, big.NewInt(actual))
+	target.Div(target, big.NewInt(expected))
+	if maxTarget := powBaseTarget(); target.Cmp(maxTarget) > 0 {
+		return maxTarget
+	}
+	return target
 }
 
 /**
  * Converts a string representation of a block to a new Block instance.
+ * Only the fields written by Block.serialize are restored; the balances
+ * and nonces of a non-genesis block must be restored with Block.rerun.
  *
  * @param {Object} o - An object representing a block, but not necessarily an instance of Block.
  *
- * @returns {Block}
+ * @returns {Block} - The block, or nil if o is not a valid serialized block.
  */
-func (b BlockChain) deserializeBlock(o []byte) *Block {
-	//need to implement
-	return nil
+func (bc BlockChain) deserializeBlock(o []byte) *Block {
+	var obj blockJson
+	if err := json.Unmarshal(o, &obj); err != nil {
+		fmt.Printf("Could not deserialize block: %v\n", err)
+		return nil
+	}
+
+	target, ok := new(big.Int).SetString(obj.Target, 16)
+	if !ok {
+		fmt.Printf("Could not deserialize block: invalid target %q\n", obj.Target)
+		return nil
+	}
+
+	reward := 0
+	b := bc.makeBlock("", nil, target, &reward)
+	b.ChainLength = obj.ChainLength
+	b.Timestamp = obj.Timestamp
+	if b.isGenesisBlock() {
+		// Balances are only stored in the genesis block.
+		for address, balance := range obj.Balances {
+			b.Balances[address] = balance
+		}
+	} else {
+		b.PrevBlockHash = []byte(obj.PrevBlockHash)
+		b.Proof = obj.Proof
+		txs := obj.Transactions
+		for _, tx := range txs {
+			// A null in the list of transactions decodes as nil.
+			if tx == nil {
+				fmt.Println("Could not deserialize block: null transaction")
+				return nil
+			}
+		}
+		if len(txs) > 0 && txs[0].isCoinbase() {
+			b.Coinbase = txs[0]
+			txs = txs[1:]
+		}
+		for _, tx := range txs {
+			b.Transactions[tx.getId()] = tx
+		}
+		// The reward address and coinbase reward are read from the coinbase
+		// transaction.  Client.validateBlock checks that it is well formed.
+		if b.Coinbase != nil && len(b.Coinbase.outputs) == 1 {
+			for address, amount := range b.Coinbase.outputs {
+				b.RewardAddr = address
+				b.CoinbaseReward = amount - b.totalRewards()
+			}
+		}
+	}
+	return b
 }
 
+/**
+ * Makes a block following b.  If the coinbase reward is not specified,
+ * the block gets the reward for its height.
+ */
 func (bc BlockChain) makeBlock(s string, b *Block, i *big.Int, c *int) *Block {
 	target := i
 	reward := c
@@ -171,19 +337,80 @@ func (bc BlockChain) makeBlock(s string, b *Block, i *big.Int, c *int) *Block {
 		target = bc.cfg.powTarget
 	}
 	if c == nil {
-		reward = &bc.cfg.coinbaseAmount
+		height := 0
+		if b != nil {
+			height = b.ChainLength + 1
+		}
+		r := bc.rewardAt(height)
+		reward = &r
 	}
 	return NewBlock(s, b, target, *reward)
 }
-func makeTransaction(tx *Transaction) *Transaction {
-	//NewTransaction(from string, nonce int, pubKey *rsa.PublicKey, sig []byte, fee int, outputs []Output, data string)
-	//in case it's not Transaction type?
-	//ntx := N (tx.from, tx.nonce, tx.pubKey, tx.sig, tx.fee, tx.outputs, tx.data)
-	//return ntx
-	if tx == nil {
+
+/**
+ * Returns the coinbase reward for the block at the specified height.
+ * The genesis block has no reward.
+ */
+func (bc BlockChain) rewardAt(height int) int {
+	if height < 1 {
+		return 0
+	}
+	return bc.TotalSupplyAt(height) - bc.TotalSupplyAt(height-1)
+}
+
+/**
+ * Returns the total gold paid out in coinbase rewards by the blocks up to and
+ * including the specified height.  Gold given out by the genesis block is not
+ * included, and neither are transaction fees, which only move existing gold.
+ *
+ * @param height - The height of the last block to count.
+ *
+ * @returns {Number} - The gold mined so far, which never exceeds cfg.maxSupply if it is set.
+ */
+func (bc BlockChain) TotalSupplyAt(height int) int {
+	total := 0
+	reward := bc.cfg.coinbaseAmount
+	for first := 1; first <= height && reward > 0; reward /= 2 {
+		// The blocks from first to last all get the same reward.
+		last := height
+		if bc.cfg.halvingInterval > 0 && first+bc.cfg.halvingInterval-1 < last {
+			last = first + bc.cfg.halvingInterval - 1
+		}
+		total += reward * (last - first + 1)
+		if bc.cfg.maxSupply > 0 && total >= bc.cfg.maxSupply {
+			return bc.cfg.maxSupply
+		}
+		first = last + 1
+	}
+	return total
+}
+
+/**
+ * Converts a transaction received from the network into a Transaction.
+ * The transaction may already be a Transaction, or it may be its JSON
+ * encoding as produced by Transaction.MarshalJSON.
+ *
+ * @param o - The transaction, as a *Transaction, []byte or string.
+ *
+ * @returns {Transaction} - The transaction, or nil if o could not be decoded.
+ */
+func makeTransaction(o interface{}) *Transaction {
+	var data []byte
+	switch v := o.(type) {
+	case *Transaction:
+		return v
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil
+	}
+
+	tx := &Transaction{}
+	if err := json.Unmarshal(data, tx); err != nil {
+		fmt.Printf("Could not deserialize transaction: %v\n", err)
 		return nil
-	} else {
-		ntx := NewTransaction(tx.from, tx.nonce, tx.pubKey, tx.sig, tx.fee, tx.outputs, "")
-		return ntx
 	}
+	return tx
 }
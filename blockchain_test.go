@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDeserializeBlockRefusesMalformedBlocks(t *testing.T) {
+	bc := testBlockChain(t)
+	g := fundedGenesis(t, bc)
+	prev := g.getId()
+
+	tests := []struct {
+		name string
+		json string
+	}{
+		{"not JSON", `{"chainLength":`},
+		{"invalid target", `{"chainLength":1,"target":"xyz","prevBlockHash":"` + prev + `"}`},
+		{"null transaction", `{"chainLength":1,"target":"ff","prevBlockHash":"` + prev + `","transactions":[null]}`},
+		{"null after the coinbase", `{"chainLength":1,"target":"ff","prevBlockHash":"` + prev + `","transactions":[{"from":"","nonce":1,"pubKey":"","outputs":{"miner":25},"fee":0,"data":""},null]}`},
+		{"transaction of the wrong type", `{"chainLength":1,"target":"ff","prevBlockHash":"` + prev + `","transactions":[7]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if block := bc.deserializeBlock([]byte(test.json)); block != nil {
+				t.Fatalf("decoded a block from %v", test.json)
+			}
+		})
+	}
+}
+
+func TestDeserializeBlockRestoresSerializedBlock(t *testing.T) {
+	bc := testBlockChain(t)
+	g, err := bc.makeGenesis(nil, map[string]int{"alice": 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := solve(bc.makeBlock("miner", g, nil, nil))
+
+	for _, block := range []*Block{g, b} {
+		restored := bc.deserializeBlock(block.toJson())
+		if restored == nil {
+			t.Fatalf("could not decode block at height %v", block.ChainLength)
+		}
+		if restored.getId() != block.getId() {
+			t.Fatalf("block at height %v has ID %v after decoding, want %v", block.ChainLength, restored.getId(), block.getId())
+		}
+	}
+}
+
+func TestNewBlockChainDerivesTargetFromLeadingZeroes(t *testing.T) {
+	cfg := DefaultCfg()
+	cfg.powLeadingZeroes = 3
+	// Left over from the default of POW_LEADING_ZEROES.
+	cfg.powTarget = powTargetFor(POW_LEADING_ZEROES)
+	bc, err := NewBlockChain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := powTargetFor(3); bc.cfg.powTarget.Cmp(want) != 0 {
+		t.Fatalf("target is %x, want %x", bc.cfg.powTarget, want)
+	}
+}
+
+func TestEmissionSchedule(t *testing.T) {
+	type point struct{ height, reward, supply int }
+	tests := []struct {
+		name            string
+		halvingInterval int
+		maxSupply       int
+		points          []point
+	}{
+		{
+			name:            "halving every 10 blocks",
+			halvingInterval: 10,
+			points: []point{
+				{0, 0, 0}, {1, 50, 50}, {10, 50, 500}, {11, 25, 525}, {20, 25, 750}, {21, 12, 762},
+				// 50, 25, 12, 6, 3 and 1 gold for 10 blocks each, and then nothing.
+				{60, 1, 970}, {61, 0, 970}, {1000, 0, 970},
+			},
+		},
+		{
+			name:            "cap reached partway through the second era",
+			halvingInterval: 10,
+			maxSupply:       520,
+			points:          []point{{10, 50, 500}, {11, 20, 520}, {12, 0, 520}, {1000, 0, 520}},
+		},
+		{
+			name:   "no halving",
+			points: []point{{1, 50, 50}, {1000, 50, 50000}},
+		},
+		{
+			name:      "no halving with a cap",
+			maxSupply: 120,
+			points:    []point{{2, 50, 100}, {3, 20, 120}, {4, 0, 120}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := DefaultCfg()
+			cfg.coinbaseAmount = 50
+			cfg.halvingInterval = test.halvingInterval
+			cfg.maxSupply = test.maxSupply
+			bc, err := NewBlockChain(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range test.points {
+				if reward := bc.rewardAt(p.height); reward != p.reward {
+					t.Fatalf("reward at height %v is %v, want %v", p.height, reward, p.reward)
+				}
+				if supply := bc.TotalSupplyAt(p.height); supply != p.supply {
+					t.Fatalf("supply at height %v is %v, want %v", p.height, supply, p.supply)
+				}
+			}
+		})
+	}
+}
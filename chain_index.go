@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+/**
+ * Maps each height on the active chain to the ID of the block at that height,
+ * so that the ancestors of the head can be found without walking back through
+ * every block.  When the head moves to another branch, only the blocks after
+ * the fork are replaced.
+ */
+type chainIndex struct {
+	blocks BlockStore
+	ids    []string
+	mu     sync.RWMutex
+}
+
+/**
+ * Creates an empty index over the blocks in the store.
+ */
+func NewChainIndex(blocks BlockStore) *chainIndex {
+	var ci chainIndex
+	ci.blocks = blocks
+	ci.ids = []string{}
+	return &ci
+}
+
+/**
+ * Makes the block the head of the active chain.  The block and all of
+ * its ancestors must already be stored.
+ *
+ * @param head - The new head of the blockchain.
+ *
+ * @returns ErrMissingParent if an ancestor of the head is not stored, in
+ *    which case the index is left unchanged.
+ */
+func (ci *chainIndex) setHead(head *Block) error {
+	ci.mu.Lock()
+	defer ci.mu.Unlock()
+
+	// Collect the IDs of the new branch, from the head back to the
+	// block where it joins the current chain.
+	branch := []string{}
+	block := head
+	for !ci.isActive(block) {
+		branch = append(branch, block.getId())
+		if block.isGenesisBlock() {
+			break
+		}
+		prevBlock := ci.blocks.get(string(block.PrevBlockHash))
+		if prevBlock == nil {
+			return fmt.Errorf("%w: %v", ErrMissingParent, string(block.PrevBlockHash))
+		}
+		block = prevBlock
+	}
+
+	forkHeight := head.ChainLength - len(branch)
+	ci.ids = ci.ids[:forkHeight+1]
+	for i := len(branch) - 1; i >= 0; i-- {
+		ci.ids = append(ci.ids, branch[i])
+	}
+	return nil
+}
+
+/**
+ * Determines whether the block is on the active chain.  The caller must hold ci.mu.
+ */
+func (ci *chainIndex) isActive(block *Block) bool {
+	return block.ChainLength < len(ci.ids) && ci.ids[block.ChainLength] == block.getId()
+}
+
+/**
+ * Returns the block at the specified height on the active chain,
+ * or nil if the chain is not that long.
+ */
+func (ci *chainIndex) blockAt(height int) *Block {
+	ci.mu.RLock()
+	defer ci.mu.RUnlock()
+	if height < 0 || height >= len(ci.ids) {
+		return nil
+	}
+	return ci.blocks.get(ci.ids[height])
+}
+
+/**
+ * Returns the ancestor of a block at the specified height.  The block need
+ * not be on the active chain; its branch is walked back until it joins the
+ * active chain, and the rest of the lookup uses the index.
+ *
+ * @param block - The block to start from.
+ * @param height - The height of the ancestor.
+ *
+ * @returns The ancestor, or nil if it is not stored or the height is above the block.
+ */
+func (ci *chainIndex) ancestor(block *Block, height int) *Block {
+	ci.mu.RLock()
+	defer ci.mu.RUnlock()
+	if height < 0 {
+		return nil
+	}
+	for block != nil && block.ChainLength > height {
+		if ci.isActive(block) {
+			return ci.blocks.get(ci.ids[height])
+		}
+		block = ci.blocks.get(string(block.PrevBlockHash))
+	}
+	if block == nil || block.ChainLength != height {
+		return nil
+	}
+	return block
+}
+
+/**
+ * Returns the IDs of the blocks on the active chain, from the genesis block to the head.
+ */
+func (ci *chainIndex) activeIds() []string {
+	ci.mu.RLock()
+	defer ci.mu.RUnlock()
+	return append([]string{}, ci.ids...)
+}
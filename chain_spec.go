@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+/**
+ * The JSON form of a Cfg, as written in a chain-spec file.  Any setting
+ * left out of the file keeps its default value.
+ */
+type cfgJson struct {
+	PowLeadingZeroes     int    `json:"powLeadingZeroes"`
+	CoinbaseAmount       int    `json:"coinbaseAmount"`
+	HalvingInterval      int    `json:"halvingInterval"`
+	MaxSupply            int    `json:"maxSupply"`
+	DefaultTxFee         int    `json:"defaultTxFee"`
+	ConfirmedDepth       int    `json:"confirmedDepth"`
+	MiningRounds         int    `json:"miningRounds"`
+	RetargetInterval     int    `json:"retargetInterval"`
+	BlockInterval        string `json:"blockInterval"`
+	MaxRetargetFactor    int64  `json:"maxRetargetFactor"`
+	MaxBlockTransactions int    `json:"maxBlockTransactions"`
+	MaxBlockSize         int    `json:"maxBlockSize"`
+}
+
+/**
+ * Returns the settings used when none are specified.
+ */
+func DefaultCfg() Cfg {
+	var cfg Cfg
+	cfg.coinbaseAmount = COINBASE_AMT_ALLOWED
+	cfg.halvingInterval = HALVING_INTERVAL
+	cfg.maxSupply = MAX_SUPPLY
+	cfg.defaultTxFee = DEFAULT_TX_FEE
+	cfg.confirmedDepth = CONFIRMED_DEPTH
+	cfg.powLeadingZeroes = POW_LEADING_ZEROES
+	cfg.powTarget = powTargetFor(POW_LEADING_ZEROES)
+	cfg.miningRounds = NUM_ROUNDS_MINING
+	cfg.retargetInterval = RETARGET_INTERVAL
+	cfg.blockInterval = TARGET_BLOCK_INTERVAL
+	cfg.maxRetargetFactor = MAX_RETARGET_FACTOR
+	cfg.maxBlockTransactions = MAX_BLOCK_TRANSACTIONS
+	cfg.maxBlockSize = MAX_BLOCK_SIZE
+	return cfg
+}
+
+/**
+ * Reads settings from a chain-spec file, e.g.
+ *
+ *   {"powLeadingZeroes": 12, "coinbaseAmount": 50, "blockInterval": "2s"}
+ *
+ * @param path - The location of the chain-spec file.
+ *
+ * @returns {Cfg} - The settings, or ErrInvalidConfig if they are not valid.
+ */
+func LoadCfg(path string) (Cfg, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Cfg{}, err
+	}
+	return parseCfg(data)
+}
+
+/**
+ * Parses the settings in a chain spec, filling in defaults for any that are missing.
+ */
+func parseCfg(data []byte) (Cfg, error) {
+	defaults := DefaultCfg()
+	o := defaults.toJsonObj()
+	if err := json.Unmarshal(data, &o); err != nil {
+		return Cfg{}, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	blockInterval, err := time.ParseDuration(o.BlockInterval)
+	if err != nil {
+		return Cfg{}, fmt.Errorf("%w: blockInterval: %v", ErrInvalidConfig, err)
+	}
+
+	var cfg Cfg
+	cfg.coinbaseAmount = o.CoinbaseAmount
+	cfg.halvingInterval = o.HalvingInterval
+	cfg.maxSupply = o.MaxSupply
+	cfg.defaultTxFee = o.DefaultTxFee
+	cfg.confirmedDepth = o.ConfirmedDepth
+	cfg.powLeadingZeroes = o.PowLeadingZeroes
+	cfg.miningRounds = o.MiningRounds
+	cfg.retargetInterval = o.RetargetInterval
+	cfg.blockInterval = blockInterval
+	cfg.maxRetargetFactor = o.MaxRetargetFactor
+	cfg.maxBlockTransactions = o.MaxBlockTransactions
+	cfg.maxBlockSize = o.MaxBlockSize
+	if err := cfg.validate(); err != nil {
+		return Cfg{}, err
+	}
+	cfg.powTarget = powTargetFor(cfg.powLeadingZeroes)
+	return cfg, nil
+}
+
+/**
+ * Converts the settings to the form written in a chain-spec file.
+ */
+func (cfg Cfg) toJsonObj() cfgJson {
+	return cfgJson{
+		PowLeadingZeroes:     cfg.powLeadingZeroes,
+		CoinbaseAmount:       cfg.coinbaseAmount,
+		HalvingInterval:      cfg.halvingInterval,
+		MaxSupply:            cfg.maxSupply,
+		DefaultTxFee:         cfg.defaultTxFee,
+		ConfirmedDepth:       cfg.confirmedDepth,
+		MiningRounds:         cfg.miningRounds,
+		RetargetInterval:     cfg.retargetInterval,
+		BlockInterval:        cfg.blockInterval.String(),
+		MaxRetargetFactor:    cfg.maxRetargetFactor,
+		MaxBlockTransactions: cfg.maxBlockTransactions,
+		MaxBlockSize:         cfg.maxBlockSize,
+	}
+}
+
+/**
+ * Checks that the settings make sense together.
+ *
+ * @returns ErrInvalidConfig, describing the first setting that is out of range.
+ */
+func (cfg Cfg) validate() error {
+	switch {
+	case cfg.powLeadingZeroes < 0 || cfg.powLeadingZeroes >= 256:
+		return fmt.Errorf("%w: powLeadingZeroes must be between 0 and 255, not %v", ErrInvalidConfig, cfg.powLeadingZeroes)
+	case cfg.coinbaseAmount < 0:
+		return fmt.Errorf("%w: coinbaseAmount must not be negative", ErrInvalidConfig)
+	case cfg.halvingInterval < 0:
+		return fmt.Errorf("%w: halvingInterval must not be negative", ErrInvalidConfig)
+	case cfg.maxSupply < 0:
+		return fmt.Errorf("%w: maxSupply must not be negative", ErrInvalidConfig)
+	case cfg.defaultTxFee < 0:
+		return fmt.Errorf("%w: defaultTxFee must not be negative", ErrInvalidConfig)
+	case cfg.confirmedDepth < 0:
+		return fmt.Errorf("%w: confirmedDepth must not be negative", ErrInvalidConfig)
+	case cfg.miningRounds <= 0:
+		return fmt.Errorf("%w: miningRounds must be positive", ErrInvalidConfig)
+	case cfg.retargetInterval < 0:
+		return fmt.Errorf("%w: retargetInterval must not be negative", ErrInvalidConfig)
+	case cfg.retargetInterval > 0 && cfg.blockInterval <= 0:
+		return fmt.Errorf("%w: blockInterval must be positive when retargeting", ErrInvalidConfig)
+	case cfg.maxRetargetFactor < 1:
+		return fmt.Errorf("%w: maxRetargetFactor must be at least 1", ErrInvalidConfig)
+	case cfg.maxBlockTransactions <= 0:
+		return fmt.Errorf("%w: maxBlockTransactions must be positive", ErrInvalidConfig)
+	case cfg.maxBlockSize <= 0:
+		return fmt.Errorf("%w: maxBlockSize must be positive", ErrInvalidConfig)
+	}
+	return nil
+}
+
+/**
+ * Returns the proof-of-work target requiring the specified number of leading zero bits.
+ */
+func powTargetFor(leadingZeroes int) *big.Int {
+	target := powBaseTarget()
+	return target.Rsh(target, uint(leadingZeroes))
+}
@@ -2,27 +2,41 @@ package main
 
 import (
 	"SpartanGold/utils"
-	"crypto/rsa"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"github.com/chuckpreslar/emission"
+	"sync"
 )
 
 type Client struct {
-	net                         *fake_net
+	net                         Network
 	name                        string
-	keyPair                     *rsa.PrivateKey
+	keyPair                     *utils.PrivateKey
 	address                     string
 	nonce                       int
 	pendingOutgoingTransactions map[string]*Transaction
 	pendingRecievedTransactions map[string]*Transaction
-	blocks                      map[string]*Block
+	blocks                      BlockStore
+	chain                       *chainIndex
 	blockChain                  *BlockChain
 	pendingBlocks               map[string][]*Block
 	lastBlock                   *Block
 	lastConfirmedBlock          *Block
 	receivedBlock               *Block
 	emitter                     *emission.Emitter
+	// Work waiting to be done by the client's own goroutine.  Every message
+	// is handled there, one at a time, so that the client's listeners never
+	// run at the same time as each other.
+	inbox *inbox
+}
+
+/**
+ * Work queued for a client, in the order it arrived.
+ */
+type inbox struct {
+	mu    sync.Mutex
+	queue []func()
+	wake  chan struct{}
 }
 
 type Message struct {
@@ -32,15 +46,50 @@ type Message struct {
 	missingB      string
 }
 
-func NewClient(name string, net *fake_net, startingBlock *Block) *Client {
+/**
+ * Creates a client that keeps its blocks in memory.
+ *
+ * @param bc - The blockchain settings, as for NewClientWithStore.
+ * @param startingBlock - The genesis block, if it has been made already.
+ */
+func NewClient(name string, net Network, bc *BlockChain, startingBlock *Block) *Client {
+	// An empty store is never refused.
+	client, _ := NewClientWithStore(name, net, bc, startingBlock, NewMemoryBlockStore(), nil)
+	return client
+}
+
+/**
+ * Creates a client that keeps its blocks in the specified store.  If the
+ * store already holds blocks, the client picks up where it left off.
+ *
+ * @param bc - The blockchain settings.  If nil, the default settings are
+ *    used until BlockChain.makeGenesis gives the client its blockchain.
+ * @param key - The client's key pair, or nil to generate a new one.
+ *
+ * @returns {Client} - The client, or ErrWrongGenesis if the store holds
+ *    blocks that do not start from startingBlock.
+ */
+func NewClientWithStore(name string, net Network, bc *BlockChain, startingBlock *Block, store BlockStore, key *utils.PrivateKey) (*Client, error) {
+	// Blocks are stored after their parent, so the genesis block is stored first.
+	stored := store.ids()
+	if len(stored) > 0 && startingBlock != nil && stored[0] != startingBlock.getId() {
+		return nil, fmt.Errorf("%w: %v, not %v", ErrWrongGenesis, stored[0], startingBlock.getId())
+	}
+
 	var client Client
 
 	client.net = net
 	client.name = name
+	client.blockChain = bc
+	if bc == nil {
+		// The default settings are always valid.
+		client.blockChain, _ = NewBlockChain(DefaultCfg())
+	}
 
-	client.keyPair = utils.GenerateKeypair()
-
-	client.address = utils.CalcAddress(&client.keyPair.PublicKey)
+	if key == nil {
+		key = utils.GenerateKeypair()
+	}
+	client.setKeyPair(key)
 
 	// Establishes order of transactions.  Incremented with each
 	// new output transaction from this client.  This feature
@@ -52,13 +101,17 @@ func NewClient(name string, net *fake_net, startingBlock *Block) *Client {
 	client.pendingOutgoingTransactions = make(map[string]*Transaction)
 	// A map of transactions received but not yet confirmed.
 	client.pendingRecievedTransactions = make(map[string]*Transaction)
-	// A map of all block hashes to the accepted blocks.
-	client.blocks = make(map[string]*Block)
+	// All accepted blocks, by block hash.
+	client.blocks = store
+	// The block IDs of the current chain, by height.
+	client.chain = NewChainIndex(store)
 	// A map of missing block IDS to the list of blocks depending
 	// on the missing blocks.
 	client.pendingBlocks = make(map[string][]*Block)
 
-	if startingBlock != nil {
+	if len(stored) > 0 {
+		client.loadBlocks()
+	} else if startingBlock != nil {
 		client.setGenesisBlock(startingBlock)
 	}
 
@@ -67,8 +120,95 @@ func NewClient(name string, net *fake_net, startingBlock *Block) *Client {
 	client.emitter = emission.NewEmitter()
 	client.emitter.On(PROOF_FOUND, client.receiveBlock)
 	client.emitter.On(MISSING_BLOCK, client.provideMissingBlock)
+	client.inbox = &inbox{wake: make(chan struct{}, 1)}
+	go client.inbox.run()
+
+	return &client, nil
+}
+
+/**
+ * Queues a message for the client's listeners.  This returns right away;
+ * the message is handled on the client's own goroutine.
+ *
+ * @param {String} msg - The name of the event (e.g. "PROOF_FOUND").
+ * @param {...Object} args - The arguments passed to the listeners.
+ */
+func (client *Client) deliver(msg string, args ...interface{}) {
+	client.enqueue(func() { client.emitter.Emit(msg, args...) })
+}
+
+/**
+ * Queues work to be done on the client's own goroutine, after any
+ * messages that are already waiting.  Anything that reads or changes the
+ * client's blocks while it is connected to a network should go through here.
+ */
+func (client *Client) enqueue(f func()) {
+	in := client.inbox
+	in.mu.Lock()
+	in.queue = append(in.queue, f)
+	in.mu.Unlock()
+	select {
+	case in.wake <- struct{}{}:
+	default:
+	}
+}
+
+/**
+ * Does the queued work, one item at a time, for as long as the process runs.
+ */
+func (in *inbox) run() {
+	for range in.wake {
+		for {
+			in.mu.Lock()
+			if len(in.queue) == 0 {
+				in.mu.Unlock()
+				break
+			}
+			f := in.queue[0]
+			in.queue = in.queue[1:]
+			in.mu.Unlock()
+			f()
+		}
+	}
+}
+
+/**
+ * Creates a client whose key pair is read from an encrypted keystore,
+ * so that it keeps the same address, and so the same gold, each time.
+ *
+ * @param bc - The blockchain settings.
+ * @param startingBlock - The genesis block of the blockchain.
+ * @param path - The keystore file, as written by Client.writeKeystore.
+ * @param passphrase - The passphrase the keystore was written with.
+ *
+ * @returns {Client} - The client, or utils.ErrWrongPassphrase if the
+ *    passphrase does not match.
+ */
+func NewClientFromKeystore(name string, net Network, bc *BlockChain, startingBlock *Block, path string, passphrase string) (*Client, error) {
+	key, err := utils.ReadKeystore(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientWithStore(name, net, bc, startingBlock, NewMemoryBlockStore(), key)
+}
 
-	return &client
+/**
+ * Sets the key pair that the client signs with, and the address derived from it.
+ * This must be done before the client is registered with a network.
+ */
+func (client *Client) setKeyPair(key *utils.PrivateKey) {
+	client.keyPair = key
+	client.address = utils.CalcAddress(key.Public())
+}
+
+/**
+ * Writes the client's key pair to a keystore, encrypted with the passphrase.
+ *
+ * @param path - Where to write the keystore.  It is only readable by the user.
+ * @param passphrase - The passphrase needed to read the keystore.
+ */
+func (client Client) writeKeystore(path string, passphrase string) error {
+	return utils.WriteKeystore(path, client.keyPair, passphrase)
 }
 
 func NewMsg(from string, msg string, prevH string, missingB string) Message {
@@ -81,6 +221,35 @@ func NewMsg(from string, msg string, prevH string, missingB string) Message {
 	return mesg
 }
 
+/**
+ * The JSON wire form of a Message.
+ */
+type messageJson struct {
+	From          string `json:"from"`
+	Msg           string `json:"msg,omitempty"`
+	PrevBlockHash string `json:"prevBlockHash,omitempty"`
+	Missing       string `json:"missing,omitempty"`
+}
+
+/**
+ * Encodes the message for sending over the network.
+ */
+func (m Message) MarshalJSON() ([]byte, error) {
+	return json.Marshal(messageJson{m.from, m.msg, m.prevBlockHash, m.missingB})
+}
+
+/**
+ * Restores a message encoded by MarshalJSON.
+ */
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var o messageJson
+	if err := json.Unmarshal(data, &o); err != nil {
+		return err
+	}
+	*m = NewMsg(o.From, o.Msg, o.PrevBlockHash, o.Missing)
+	return nil
+}
+
 /**
  * The genesis block can only be set if the client does not already
  * have the genesis block.
@@ -94,7 +263,33 @@ func (client *Client) setGenesisBlock(startingBlock *Block) {
 
 	client.lastConfirmedBlock = startingBlock
 	client.lastBlock = startingBlock
-	client.blocks[startingBlock.getId()] = startingBlock
+	if err := client.blocks.put(startingBlock); err != nil {
+		fmt.Printf("Could not store genesis block: %v\n", err)
+	}
+	client.chain.setHead(startingBlock)
+}
+
+/**
+ * Restores the blockchain from the client's block store, making the
+ * longest stored chain the current one.
+ */
+func (client *Client) loadBlocks() {
+	for _, id := range client.blocks.ids() {
+		block := client.blocks.get(id)
+		if block == nil {
+			continue
+		}
+		if block.isBetterThan(client.lastBlock) {
+			client.lastBlock = block
+		}
+	}
+	if client.lastBlock != nil {
+		if err := client.chain.setHead(client.lastBlock); err != nil {
+			fmt.Printf("Could not restore the blockchain: %v\n", err)
+			return
+		}
+		client.setLastConfirmed()
+	}
 }
 
 /**
@@ -129,25 +324,29 @@ func (client Client) getAvailableGold() int {
  *    amounts to pay.
  * @param  [fee] - The transaction fee reward to pay the miner.
  *
- * @returns Transaction - The posted transaction.
+ * @returns Transaction - The posted transaction, ErrInvalidAddress if an output
+ *    address is malformed, or ErrInsufficientFunds if the client does not have
+ *    enough available gold.
  */
-func (client *Client) postTransaction(outputs map[string]int, fee int) *Transaction {
+func (client *Client) postTransaction(outputs map[string]int, fee int) (*Transaction, error) {
 
-	f := DEFAULT_TX_FEE
-	if fee > DEFAULT_TX_FEE {
+	f := client.blockChain.cfg.defaultTxFee
+	if fee > f {
 		f = fee
 	}
 	totalPayments := f
-	for _, amount := range outputs {
+	for address, amount := range outputs {
+		if err := utils.ValidateAddress(address); err != nil {
+			return nil, err
+		}
 		totalPayments += amount
 	}
 
 	if totalPayments > client.getAvailableGold() {
-		err := "Requested" + string(totalPayments) + ", but account only has" + string(client.getAvailableGold())
-		errors.New(err)
+		return nil, fmt.Errorf("%w: requested %v, but account only has %v", ErrInsufficientFunds, totalPayments, client.getAvailableGold())
 	}
 
-	return client.postGenericTransaction(outputs, f)
+	return client.postGenericTransaction(outputs, f), nil
 }
 
 /**
@@ -161,13 +360,18 @@ func (client *Client) postTransaction(outputs map[string]int, fee int) *Transact
  */
 
 func (client *Client) postGenericTransaction(outputs map[string]int, fee int) *Transaction {
-	tx := NewTransaction(client.address, client.nonce, &client.keyPair.PublicKey, nil, fee, outputs, "")
+	// A client restored from a keystore may have used nonces before it started.
+	nonce := client.nonce
+	if client.lastBlock != nil && client.lastBlock.NextNonce[client.address] > nonce {
+		nonce = client.lastBlock.NextNonce[client.address]
+	}
+	tx := NewTransaction(client.address, nonce, client.keyPair.Public(), nil, fee, outputs, "")
 	tx.sign(client.keyPair)
 	fmt.Printf("Transaction created %v - Signed? %v \n", tx.getId(), tx.validSignature())
 	client.pendingOutgoingTransactions[tx.getId()] = tx
-	client.nonce++
-	fmt.Printf("NONCE %v \n", tx.getId(), client.nonce)
-	client.net.broadcast(POST_TRANSACTION, tx)
+	client.nonce = nonce + 1
+	fmt.Printf("NONCE %v %v \n", tx.getId(), client.nonce)
+	client.net.broadcast(client.address, POST_TRANSACTION, tx)
 	fmt.Printf("AFTER POST_TRANSACTION in postransaction client.go %v \n", tx.outputs)
 
 	return tx
@@ -186,32 +390,41 @@ func (client *Client) postGenericTransaction(outputs map[string]int, fee int) *T
  *
  * @param {Block | Object} block - The block to add to the clients list of available blocks.
  *
- * @returns {Block | null} The block with rerun transactions, or null for an invalid block.
+ * @returns {Block | null} The block with rerun transactions, or null with the reason
+ *    the block was not accepted: ErrDuplicateBlock, ErrMissingParent, ErrInvalidProof,
+ *    a *BlockValidationError (including for any block claiming to be a genesis
+ *    block), or the error of the first invalid transaction.
  */
-func (c *Client) receiveBlock(b *Block) *Block {
+func (c *Client) receiveBlock(b *Block) (*Block, error) {
 	block := b
 
 	//if block is a string, deserialize (need to implement)
 
 	//recieved previously
-	if _, ok := c.blocks[block.getId()]; ok {
+	if c.blocks.get(block.getId()) != nil {
 		//errors.New("Block was recieved previously")
 		fmt.Printf("Block %v was recieved previously\n", string(block.getId()))
-		return nil //just ignore, no error
+		return nil, fmt.Errorf("%w: %v", ErrDuplicateBlock, block.getId())
+	}
+
+	// A client only gets its genesis block from setGenesisBlock, so any
+	// other block claiming to start a chain is refused.
+	if block.isGenesisBlock() {
+		err := &BlockValidationError{REJECT_WRONG_CHAIN_LENGTH, block.getId(), "only the genesis block may have a chain length of 0"}
+		fmt.Println(err)
+		return nil, err
 	}
 
 	//doesn't have valid proof
-	if !block.hasValidProof() && !block.isGenesisBlock() {
+	if !block.hasValidProof() {
 		fmt.Printf("Block %v does not have a valid proof\n", string(block.getId()))
-		return nil
+		return nil, fmt.Errorf("%w for block %v", ErrInvalidProof, block.getId())
 	}
 
-	// Make sure that we have the previous blocks, unless it is the genesis block.
+	// Make sure that we have the previous blocks.
 	// If we don't have the previous blocks, request the missing blocks and exit.
-	var prevBlock *Block = nil
-
-	prevBlock, ok := c.blocks[string(block.PrevBlockHash)]
-	if !ok && !block.isGenesisBlock() {
+	prevBlock := c.blocks.get(string(block.PrevBlockHash))
+	if prevBlock == nil {
 		stuckBlocks, ok := c.pendingBlocks[string(block.PrevBlockHash)]
 		if !ok { //stuck block undefined
 			c.requestMissingBlock(block)
@@ -219,24 +432,34 @@ func (c *Client) receiveBlock(b *Block) *Block {
 		}
 		stuckBlocks = append(stuckBlocks, block)
 		c.pendingBlocks[string(block.PrevBlockHash)] = stuckBlocks
-		return nil
+		return nil, fmt.Errorf("%w: %v", ErrMissingParent, string(block.PrevBlockHash))
 	}
 
-	if !block.isGenesisBlock() {
-		success := block.rerun(prevBlock)
-		if !success {
-			return nil
-		}
+	// Among other rules, this checks that the block follows directly after its parent.
+	if err := c.validateBlock(block, prevBlock); err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	if err := block.rerun(prevBlock); err != nil {
+		fmt.Printf("Block %v rejected: %v\n", block.getId(), err)
+		return nil, err
 	}
 
 	// Storing the block.
-	c.blocks[block.getId()] = block
+	if err := c.blocks.put(block); err != nil {
+		fmt.Printf("Could not store block %v: %v\n", block.getId(), err)
+		return nil, err
+	}
 
 	// If it is a better block than the client currently has, set that
 	// as the new currentBlock, and update the lastConfirmedBlock.
-	if c.lastBlock.ChainLength < block.ChainLength {
-		c.lastBlock = block
-		c.setLastConfirmed()
+	if block.isBetterThan(c.lastBlock) {
+		if err := c.chain.setHead(block); err != nil {
+			fmt.Printf("Could not switch to block %v: %v\n", block.getId(), err)
+		} else {
+			c.lastBlock = block
+			c.setLastConfirmed()
+		}
 	}
 
 	// Go through any blocks that were waiting for this block
@@ -248,10 +471,10 @@ func (c *Client) receiveBlock(b *Block) *Block {
 	// Remove these blocks from the pending set.
 	delete(c.pendingBlocks, block.getId())
 	for _, ub := range unstuckBlocks {
-		fmt.Printf("Processing unstuck block %v", block.getId())
+		fmt.Printf("Processing unstuck block %v\n", ub.getId())
 		c.receiveBlock(ub)
 	}
-	return block
+	return block, nil
 }
 
 func (c *Client) receive(b *Block) {
@@ -264,9 +487,9 @@ func (c *Client) receive(b *Block) {
  * @param {Block} block - The block that is connected to a missing block.
  */
 func (client Client) requestMissingBlock(block *Block) {
-	fmt.Printf("%v asks for missing block: %v", client, block.PrevBlockHash)
-	var msg = Message{client.address, "", string(block.PrevBlockHash), ""}
-	client.net.broadcast(MISSING_BLOCK, msg)
+	fmt.Printf("%v asks for missing block: %v\n", client.name, string(block.PrevBlockHash))
+	var msg = Message{client.address, "", "", string(block.PrevBlockHash)}
+	client.net.broadcast(client.address, MISSING_BLOCK, msg)
 }
 
 /**
@@ -274,7 +497,7 @@ func (client Client) requestMissingBlock(block *Block) {
  */
 func (client Client) resendPendingTransactions() {
 	for _, tx := range client.pendingOutgoingTransactions {
-		client.net.broadcast(POST_TRANSACTION, tx)
+		client.net.broadcast(client.address, POST_TRANSACTION, tx)
 
 	}
 }
@@ -289,10 +512,9 @@ func (client Client) resendPendingTransactions() {
  */
 func (client Client) provideMissingBlock(msg Message) {
 	if msg.missingB != "" {
-		if client.blocks[msg.missingB] != nil {
-			fmt.Printf("Providing missing block %v", msg.missingB)
-			mblock := client.blocks[msg.missingB]
-			client.net.sendMessage(msg.from, PROOF_FOUND, mblock)
+		if mblock := client.blocks.get(msg.missingB); mblock != nil {
+			fmt.Printf("Providing missing block %v\n", msg.missingB)
+			client.net.sendMessage(client.address, msg.from, PROOF_FOUND, mblock)
 		}
 	}
 }
@@ -303,18 +525,16 @@ func (client Client) provideMissingBlock(msg Message) {
  * Note that the genesis block is always considered to be confirmed.
  */
 func (client *Client) setLastConfirmed() {
-	block := client.lastBlock
-	confirmedBlockHeight := block.ChainLength - CONFIRMED_DEPTH
+	confirmedBlockHeight := client.lastBlock.ChainLength - client.blockChain.cfg.confirmedDepth
 	if confirmedBlockHeight < 0 {
 		confirmedBlockHeight = 0
 	}
 
-	for block.ChainLength > confirmedBlockHeight {
-		if _, ok := client.blocks[string(block.PrevBlockHash)]; ok {
-			block = client.blocks[string(block.PrevBlockHash)]
-		}
+	block := client.chain.blockAt(confirmedBlockHeight)
+	if block == nil {
+		fmt.Printf("Block at height %v is not stored\n", confirmedBlockHeight)
+		return
 	}
-
 	client.lastConfirmedBlock = block
 
 	// Update pending transactions according to the new last confirmed block.
@@ -360,9 +580,8 @@ func (client Client) log(msg Message) {
  * to the genesis block.  Only the Block IDs are printed.
  */
 func (client Client) showBlockchain() {
-	block := client.lastBlock
-	for block != nil {
-		fmt.Println(block.getId())
-		block = client.blocks[string(block.PrevBlockHash)]
+	ids := client.chain.activeIds()
+	for i := len(ids) - 1; i >= 0; i-- {
+		fmt.Println(ids[i])
 	}
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/**
+ * Returns a blockchain that adjusts its difficulty every 2 blocks, so that
+ * a chain can be made easier or harder to mine through its timestamps.
+ */
+func retargetingBlockChain(t *testing.T) *BlockChain {
+	t.Helper()
+	cfg := DefaultCfg()
+	cfg.powLeadingZeroes = 4
+	cfg.retargetInterval = 2
+	cfg.blockInterval = time.Second
+	bc, err := NewBlockChain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+/**
+ * Mines a block on top of prev with the specified timestamp and has the client
+ * receive it.  Its target is whatever the client expects after prev.
+ */
+func extendChain(t *testing.T, c *Client, rewardAddr string, prev *Block, timestamp time.Time) *Block {
+	t.Helper()
+	bc := c.blockChain
+	b := bc.makeBlock(rewardAddr, prev, bc.expectedTarget(prev, c.chain), nil)
+	b.Timestamp = timestamp
+	solve(b)
+	block, err := c.receiveBlock(copyBlock(t, bc, b))
+	if err != nil {
+		t.Fatalf("block at height %v refused: %v", b.ChainLength, err)
+	}
+	return block
+}
+
+func TestHeavierForkWinsOverLongerFork(t *testing.T) {
+	for _, heavyFirst := range []bool{false, true} {
+		bc := retargetingBlockChain(t)
+		start := time.Now().Add(-time.Hour)
+		g, err := bc.makeGenesisAt(nil, map[string]int{}, start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := NewClient("C", NewFakeNet(), bc, g)
+
+		// Both forks share blocks 1 to 3, found at the intended pace.
+		prefix := g
+		for i := 1; i <= 3; i++ {
+			prefix = extendChain(t, c, "common", prefix, start.Add(time.Duration(i)*time.Second))
+		}
+
+		// Blocks found slowly make the target easier at each adjustment,
+		// so this fork grows long while adding little work.
+		light := func() *Block {
+			b := prefix
+			for i := 1; i <= 6; i++ {
+				b = extendChain(t, c, "light", b, start.Add(time.Duration(3+100*i)*time.Second))
+			}
+			return b
+		}
+		// Blocks found quickly make the target harder, so this fork
+		// is shorter but has more work.
+		heavy := func() *Block {
+			b := prefix
+			for i := 1; i <= 3; i++ {
+				b = extendChain(t, c, "heavy", b, start.Add(3*time.Second+time.Duration(i)*100*time.Millisecond))
+			}
+			return b
+		}
+
+		var lightHead, heavyHead *Block
+		if heavyFirst {
+			heavyHead = heavy()
+			lightHead = light()
+		} else {
+			lightHead = light()
+			heavyHead = heavy()
+		}
+
+		if lightHead.ChainLength <= heavyHead.ChainLength {
+			t.Fatalf("light fork has length %v, heavy fork %v; the light fork should be longer", lightHead.ChainLength, heavyHead.ChainLength)
+		}
+		if lightHead.TotalWork.Cmp(heavyHead.TotalWork) >= 0 {
+			t.Fatalf("light fork has work %v, heavy fork %v; the heavy fork should have more", lightHead.TotalWork, heavyHead.TotalWork)
+		}
+		if c.lastBlock.getId() != heavyHead.getId() {
+			t.Fatalf("head is at height %v, want the heavy fork's head at height %v (heavy fork received first: %v)", c.lastBlock.ChainLength, heavyHead.ChainLength, heavyFirst)
+		}
+	}
+}
+
+func TestEqualWorkForksBreakTieByLowerId(t *testing.T) {
+	bc := testBlockChain(t)
+	g := fundedGenesis(t, bc)
+	a := solve(bc.makeBlock("a", g, nil, nil))
+	b := solve(bc.makeBlock("b", g, nil, nil))
+	want := a.getId()
+	if b.getId() < want {
+		want = b.getId()
+	}
+
+	for _, order := range [][]*Block{{a, b}, {b, a}} {
+		c := NewClient("C", NewFakeNet(), bc, g)
+		for _, block := range order {
+			if _, err := c.receiveBlock(copyBlock(t, bc, block)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if c.lastBlock.getId() != want {
+			t.Fatalf("head is %v, want the lower ID %v", c.lastBlock.getId(), want)
+		}
+	}
+}
+
+func TestClientRestoredFromKeystoreCanSpend(t *testing.T) {
+	bc := testBlockChain(t)
+	key := utils.GenerateKeypair()
+	g := fundedGenesis(t, bc, key)
+	m := NewMiner("Miner", NewFakeNet(), bc, g)
+
+	original, err := NewClientWithStore("Original", NewFakeNet(), bc, g, NewMemoryBlockStore(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := original.postTransaction(map[string]int{m.MClient.address: 10}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.addTransaction(tx)
+	blocks := []*Block{mineBlock(t, m, original)}
+	for i := 0; i < 3; i++ {
+		blocks = append(blocks, mineBlock(t, m, original))
+	}
+
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	if err := original.writeKeystore(path, "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := NewClientFromKeystore("Restored", NewFakeNet(), bc, g, path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.address != original.address {
+		t.Fatalf("restored client has address %v, want %v", restored.address, original.address)
+	}
+	for _, block := range blocks {
+		if _, err := restored.receiveBlock(copyBlock(t, bc, block)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, err = restored.postTransaction(map[string]int{m.MClient.address: 20}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.nonce != 1 {
+		t.Fatalf("restored client used nonce %v, want 1", tx.nonce)
+	}
+	if !m.addTransaction(tx) {
+		t.Fatal("miner refused the restored client's payment")
+	}
+	if block := mineBlock(t, m, restored); !block.contains(tx) {
+		t.Fatal("the restored client's payment was not mined")
+	}
+}
+
+func TestPostTransactionRefusesInvalidAddress(t *testing.T) {
+	bc := testBlockChain(t)
+	key := utils.GenerateKeypair()
+	g := fundedGenesis(t, bc, key)
+	c, err := NewClientWithStore("C", NewFakeNet(), bc, g, NewMemoryBlockStore(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payee := utils.CalcAddress(utils.GenerateKeypair().Public())
+	typo := payee[:len(payee)-1] + "1"
+	if typo == payee {
+		typo = payee[:len(payee)-1] + "2"
+	}
+	for _, address := range []string{typo, "bob"} {
+		tx, err := c.postTransaction(map[string]int{payee: 10, address: 10}, 0)
+		if !errors.Is(err, ErrInvalidAddress) {
+			t.Fatalf("paying %v: got %v, want ErrInvalidAddress", address, err)
+		}
+		if tx != nil || len(c.pendingOutgoingTransactions) != 0 || c.nonce != 0 {
+			t.Fatalf("paying %v posted a transaction", address)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"errors"
+)
+
+// Errors returned when a transaction cannot be added to a block.
+// They are wrapped with the ID of the transaction, so use errors.Is to test for them.
+var (
+	ErrInsufficientFunds = errors.New("insufficient gold")
+	ErrInvalidSignature  = errors.New("invalid signature")
+	ErrReplayedTx        = errors.New("replayed transaction")
+	ErrOutOfOrderTx      = errors.New("out of order transaction")
+	ErrDuplicateTx       = errors.New("duplicate transaction")
+)
+
+// Returned when a transaction is posted to a malformed address.
+var ErrInvalidAddress = utils.ErrInvalidAddress
+
+// Errors returned when a block is not accepted.
+var (
+	ErrInvalidProof   = errors.New("invalid proof")
+	ErrDuplicateBlock = errors.New("block was received previously")
+	ErrMissingParent  = errors.New("previous block is missing")
+)
+
+// Returned when a block store holds the blocks of a different blockchain.
+var ErrWrongGenesis = errors.New("stored blocks start from a different genesis block")
+
+// Returned when the blockchain settings are inconsistent.
+var ErrInvalidConfig = errors.New("invalid blockchain configuration")
@@ -1,12 +1,56 @@
 package main
 
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/**
+ * Settings for how unreliable a fake_net is.  The zero value delivers
+ * every message immediately and exactly once.
+ */
+type FakeNetOptions struct {
+	// Probability, from 0 to 1, that a message is lost.
+	ChanceMessageFails float64
+	// Probability, from 0 to 1, that a message is delivered twice.
+	ChanceMessageDuplicated float64
+	// Each delivery is delayed by a random duration between MinDelay and MaxDelay.
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// Seed for the random number generator, so that a run can be reproduced.
+	Seed int64
+}
+
 type fake_net struct {
 	Clients map[string]*Client
+	opts    FakeNetOptions
+	rng     *rand.Rand
+	// The name of the partition each client has been split off into, by address.
+	// Clients that are not listed are in the main network.
+	partitions map[string]string
+	// Guards Clients, rng and partitions, since clients may register
+	// while others are broadcasting.
+	mu sync.RWMutex
 }
 
 func NewFakeNet() *fake_net {
+	return NewFakeNetWithOptions(FakeNetOptions{})
+}
+
+/**
+ * Creates a network that loses, delays and duplicates messages
+ * according to the specified options.
+ *
+ * @param opts - How unreliable the network is.
+ */
+func NewFakeNetWithOptions(opts FakeNetOptions) *fake_net {
 	var f fake_net
 	f.Clients = make(map[string]*Client)
+	f.opts = opts
+	f.rng = rand.New(rand.NewSource(opts.Seed))
+	f.partitions = make(map[string]string)
 	return &f
 }
 
@@ -17,6 +61,8 @@ func NewFakeNet() *fake_net {
  * @param {...Object} clientList - clients to be registered to this network (may be Client or Miner)
  */
 func (f *fake_net) register(clientList []*Client) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	for _, client := range clientList {
 		f.Clients[client.address] = client
 	}
@@ -26,12 +72,20 @@ func (f *fake_net) register(clientList []*Client) {
 /**
  * Broadcasts to all clients within this.clients the message msg and payload o.
  *
+ * @param {String} from - the public key address of the client sending the message
  * @param {String} msg - the name of the event being broadcasted (e.g. "PROOF_FOUND")
  * @param {Object} o - payload of the message
  */
-func (f *fake_net) broadcast(msg string, o interface{}) {
-	for address, _ := range f.Clients {
-		f.sendMessage(address, msg, o)
+func (f *fake_net) broadcast(from string, msg string, o interface{}) {
+	f.mu.RLock()
+	addresses := make([]string, 0, len(f.Clients))
+	for address := range f.Clients {
+		addresses = append(addresses, address)
+	}
+	f.mu.RUnlock()
+
+	for _, address := range addresses {
+		f.sendMessage(from, address, msg, o)
 	}
 }
 
@@ -39,17 +93,125 @@ func (f *fake_net) broadcast(msg string, o interface{}) {
  * Sends message msg and payload o directly to Client name.
  *
  * The message may be lost or delayed, with the probability
- * defined for this instance.
+ * defined for this instance.  Messages between clients in different
+ * partitions are always lost, and messages that a client sends
+ * to itself are always delivered immediately.
  *
+ * @param {String} from - the public key address of the client sending the message
  * @param {String} address - the public key address of the client or miner to which to send the message
  * @param {String} msg - the name of the event being broadcasted (e.g. "PROOF_FOUND")
  * @param {Object} o - payload of the message
  */
-func (f *fake_net) sendMessage(address string, msg string, jsonObj interface{}) {
+func (f *fake_net) sendMessage(from string, address string, msg string, jsonObj interface{}) {
+	f.mu.RLock()
+	client, ok := f.Clients[address]
+	reachable := f.partitions[from] == f.partitions[address]
+	f.mu.RUnlock()
+	if !ok || !reachable {
+		return
+	}
+
 	// Serializing/deserializing the object to prevent cheating in single threaded mode.
-	//...
-	client := f.Clients[address]
-	client.emitter.Emit(msg, jsonObj)
+	data, err := encodePayload(jsonObj)
+	if err != nil {
+		fmt.Printf("Could not serialize %v message: %v\n", msg, err)
+		return
+	}
+
+	if from == address {
+		f.deliver(client, msg, data)
+		return
+	}
+
+	for _, delay := range f.deliveryDelays() {
+		if delay == 0 {
+			f.deliver(client, msg, data)
+			continue
+		}
+		go func(delay time.Duration) {
+			time.Sleep(delay)
+			f.deliver(client, msg, data)
+		}(delay)
+	}
+}
+
+/**
+ * Decides how many times a message is delivered, and how long each
+ * delivery is delayed.
+ *
+ * @returns - One delay per delivery; empty if the message is lost.
+ */
+func (f *fake_net) deliveryDelays() []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	copies := 1
+	if f.rng.Float64() < f.opts.ChanceMessageFails {
+		copies = 0
+	} else if f.rng.Float64() < f.opts.ChanceMessageDuplicated {
+		copies = 2
+	}
+
+	delays := []time.Duration{}
+	for i := 0; i < copies; i++ {
+		delay := f.opts.MinDelay
+		if f.opts.MaxDelay > f.opts.MinDelay {
+			delay += time.Duration(f.rng.Int63n(int64(f.opts.MaxDelay - f.opts.MinDelay + 1)))
+		}
+		delays = append(delays, delay)
+	}
+	return delays
+}
+
+/**
+ * Decodes a fresh copy of the payload for the client and hands it to its listeners.
+ */
+func (f *fake_net) deliver(client *Client, msg string, data []byte) {
+	o := decodePayload(msg, data, client.blockChain)
+	if o == nil {
+		return
+	}
+	client.deliver(msg, o)
+}
+
+/**
+ * Splits clients off into a named partition.  Clients in a partition
+ * can only reach other clients in the same partition.  A client can
+ * only be in one partition, so it is moved if it was already in another.
+ *
+ * @param {String} name - the name of the partition
+ * @param {Array} addresses - the public key addresses of the clients to split off
+ */
+func (f *fake_net) partition(name string, addresses []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, address := range addresses {
+		f.partitions[address] = name
+	}
+}
+
+/**
+ * Rejoins the clients of a named partition with the main network.
+ *
+ * @param {String} name - the name of the partition
+ */
+func (f *fake_net) heal(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for address, partition := range f.partitions {
+		if partition == name {
+			delete(f.partitions, address)
+		}
+	}
+}
+
+/**
+ * Rejoins every partition with the main network.
+ */
+func (f *fake_net) healAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.partitions = make(map[string]string)
 }
 
 /**
@@ -60,6 +222,8 @@ func (f *fake_net) sendMessage(address string, msg string, jsonObj interface{})
  * @returns {boolean} True if the client is already registered.
  */
 func (f *fake_net) recognizes(client Client) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
 	if _, ok := f.Clients[client.address]; ok {
 		return true
 	} else {
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"testing"
+	"time"
+)
+
+/**
+ * Returns a channel that receives every transaction posted to the client.
+ */
+func recordTransactions(c *Client) chan *Transaction {
+	received := make(chan *Transaction, 1000)
+	c.emitter.On(POST_TRANSACTION, func(tx *Transaction) { received <- tx })
+	return received
+}
+
+/**
+ * Returns two clients registered with the network, the second
+ * recording the transactions it receives.
+ */
+func fakeNetPair(t *testing.T, net *fake_net) (*Client, *Client, chan *Transaction) {
+	t.Helper()
+	bc := testBlockChain(t)
+	g := fundedGenesis(t, bc)
+	sender := NewClient("Sender", net, bc, g)
+	receiver := NewClient("Receiver", net, bc, g)
+	net.register([]*Client{sender, receiver})
+	return sender, receiver, recordTransactions(receiver)
+}
+
+/**
+ * Waits for the next transaction, failing the test if none arrives in time.
+ */
+func nextTransaction(t *testing.T, received chan *Transaction, timeout time.Duration) *Transaction {
+	t.Helper()
+	select {
+	case tx := <-received:
+		return tx
+	case <-time.After(timeout):
+		t.Fatal("no message was delivered")
+		return nil
+	}
+}
+
+/**
+ * Fails the test if a transaction arrives within the specified time.
+ */
+func expectNoTransaction(t *testing.T, received chan *Transaction, wait time.Duration) {
+	t.Helper()
+	select {
+	case tx := <-received:
+		t.Fatalf("unexpected delivery of the payment with nonce %v", tx.nonce)
+	case <-time.After(wait):
+	}
+}
+
+func TestFakeNetSeedReproducesLostAndDuplicatedMessages(t *testing.T) {
+	const MESSAGES = 500
+	opts := FakeNetOptions{ChanceMessageFails: 0.3, ChanceMessageDuplicated: 0.3, Seed: 42}
+
+	// A second network with the same seed decides the fate of each message
+	// the same way, so it shows which deliveries the first should make.
+	want := make(map[int]int)
+	lost, duplicated := 0, 0
+	oracle := NewFakeNetWithOptions(opts)
+	for nonce := 0; nonce < MESSAGES; nonce++ {
+		copies := len(oracle.deliveryDelays())
+		want[nonce] = copies
+		if copies == 0 {
+			lost++
+		} else if copies == 2 {
+			duplicated++
+		}
+	}
+	// Roughly 30% of the messages are lost, and 30% of the rest duplicated.
+	if lost < MESSAGES/5 || lost > MESSAGES*2/5 {
+		t.Fatalf("%v of %v messages lost, want about 30%%", lost, MESSAGES)
+	}
+	if duplicated < MESSAGES/8 || duplicated > MESSAGES*3/10 {
+		t.Fatalf("%v of %v messages duplicated, want about 21%%", duplicated, MESSAGES)
+	}
+
+	net := NewFakeNetWithOptions(opts)
+	sender, receiver, received := fakeNetPair(t, net)
+	key := utils.GenerateKeypair()
+	total := 0
+	for nonce := 0; nonce < MESSAGES; nonce++ {
+		net.sendMessage(sender.address, receiver.address, POST_TRANSACTION, signedPayment(key, nonce, "payee", 1))
+		total += want[nonce]
+	}
+
+	got := make(map[int]int)
+	for i := 0; i < total; i++ {
+		got[nextTransaction(t, received, 5*time.Second).nonce]++
+	}
+	expectNoTransaction(t, received, 50*time.Millisecond)
+	for nonce := 0; nonce < MESSAGES; nonce++ {
+		if got[nonce] != want[nonce] {
+			t.Fatalf("payment %v delivered %v times, but the seed decides on %v", nonce, got[nonce], want[nonce])
+		}
+	}
+}
+
+func TestFakeNetDelaysMessages(t *testing.T) {
+	const MIN_DELAY, MAX_DELAY = 50 * time.Millisecond, 150 * time.Millisecond
+	opts := FakeNetOptions{MinDelay: MIN_DELAY, MaxDelay: MAX_DELAY, Seed: 7}
+
+	oracle := NewFakeNetWithOptions(opts)
+	for i := 0; i < 1000; i++ {
+		for _, delay := range oracle.deliveryDelays() {
+			if delay < MIN_DELAY || delay > MAX_DELAY {
+				t.Fatalf("delay of %v is outside of %v to %v", delay, MIN_DELAY, MAX_DELAY)
+			}
+		}
+	}
+
+	net := NewFakeNetWithOptions(opts)
+	sender, receiver, received := fakeNetPair(t, net)
+	start := time.Now()
+	net.sendMessage(sender.address, receiver.address, POST_TRANSACTION, signedPayment(utils.GenerateKeypair(), 0, "payee", 1))
+	nextTransaction(t, received, 5*time.Second)
+	if elapsed := time.Since(start); elapsed < MIN_DELAY {
+		t.Fatalf("message delivered after %v, before the minimum delay of %v", elapsed, MIN_DELAY)
+	}
+}
+
+func TestFakeNetPartitionBlocksMessagesUntilHealed(t *testing.T) {
+	net := NewFakeNet()
+	sender, receiver, received := fakeNetPair(t, net)
+	key := utils.GenerateKeypair()
+
+	net.partition("split", []string{receiver.address})
+	net.broadcast(sender.address, POST_TRANSACTION, signedPayment(key, 0, "payee", 1))
+	expectNoTransaction(t, received, 100*time.Millisecond)
+
+	// Clients in the same partition can still reach each other.
+	net.partition("split", []string{sender.address})
+	net.sendMessage(sender.address, receiver.address, POST_TRANSACTION, signedPayment(key, 1, "payee", 1))
+	if tx := nextTransaction(t, received, time.Second); tx.nonce != 1 {
+		t.Fatalf("received the payment with nonce %v, want 1", tx.nonce)
+	}
+
+	net.partition("other", []string{sender.address})
+	net.sendMessage(sender.address, receiver.address, POST_TRANSACTION, signedPayment(key, 2, "payee", 1))
+	expectNoTransaction(t, received, 100*time.Millisecond)
+
+	// Healing one side is not enough while the other is still split off.
+	net.heal("split")
+	net.sendMessage(sender.address, receiver.address, POST_TRANSACTION, signedPayment(key, 2, "payee", 1))
+	expectNoTransaction(t, received, 100*time.Millisecond)
+
+	net.heal("other")
+	net.sendMessage(sender.address, receiver.address, POST_TRANSACTION, signedPayment(key, 3, "payee", 1))
+	if tx := nextTransaction(t, received, time.Second); tx.nonce != 3 {
+		t.Fatalf("received the payment with nonce %v, want 3", tx.nonce)
+	}
+}
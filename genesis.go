@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+/**
+ * The JSON form of a genesis file.  Every node started from the same
+ * file builds the same genesis block and uses the same settings.
+ */
+type genesisJson struct {
+	ChainId   string          `json:"chainId,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	Balances  map[string]int  `json:"balances"`
+	Config    json.RawMessage `json:"config"`
+}
+
+/**
+ * Reads a genesis file and builds the genesis block it describes.
+ * If the file records a chain ID, it must match the one calculated
+ * from the genesis block and settings.
+ *
+ * @param path - The location of the genesis file.
+ *
+ * @returns The blockchain and its genesis block, or ErrInvalidConfig if
+ *    the settings are not valid or the chain ID does not match.
+ */
+func LoadGenesis(path string) (*BlockChain, *Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var o genesisJson
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	cfg := DefaultCfg()
+	if len(o.Config) > 0 {
+		if cfg, err = parseCfg(o.Config); err != nil {
+			return nil, nil, err
+		}
+	}
+	bc, err := NewBlockChain(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	balances := o.Balances
+	if balances == nil {
+		balances = make(map[string]int)
+	}
+	g, err := bc.makeGenesisAt(nil, balances, o.Timestamp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if o.ChainId != "" && o.ChainId != bc.chainId {
+		return nil, nil, fmt.Errorf("%w: %v records chain %v, but its contents are for chain %v", ErrInvalidConfig, path, o.ChainId, bc.chainId)
+	}
+	return bc, g, nil
+}
+
+/**
+ * Writes the genesis block and settings to a genesis file,
+ * so that other nodes can join the same blockchain.
+ *
+ * @param path - The location of the genesis file.
+ * @param g - The genesis block made by this blockchain.
+ */
+func (bc *BlockChain) writeGenesis(path string, g *Block) error {
+	config, err := json.Marshal(bc.cfg.toJsonObj())
+	if err != nil {
+		return err
+	}
+	o := genesisJson{bc.chainId, g.Timestamp.UTC(), g.Balances, config}
+	data, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+/**
+ * Calculates the ID of a blockchain from its genesis block and settings,
+ * so that nodes with the same genesis block but different rules do not
+ * mistake each other for peers.
+ */
+func calcChainId(g *Block, cfg Cfg) string {
+	config, err := json.Marshal(cfg.toJsonObj())
+	if err != nil {
+		panic(err)
+	}
+	h := sha256.New()
+	h.Write([]byte("CHAIN"))
+	h.Write([]byte(g.getId()))
+	h.Write(config)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/**
+ * Writes a genesis file for a funded genesis block and returns its path.
+ */
+func writeTestGenesis(t *testing.T, bc *BlockChain) (string, *Block) {
+	t.Helper()
+	g := fundedGenesis(t, bc, utils.GenerateKeypair())
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	if err := bc.writeGenesis(path, g); err != nil {
+		t.Fatal(err)
+	}
+	return path, g
+}
+
+func TestGenesisFileRoundTrip(t *testing.T) {
+	bc := testBlockChain(t)
+	path, g := writeTestGenesis(t, bc)
+
+	loaded, loadedGenesis, err := LoadGenesis(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.chainId == "" {
+		t.Fatal("making the genesis block did not set the chain ID")
+	}
+	if loaded.chainId != bc.chainId {
+		t.Fatalf("loaded chain %v, want %v", loaded.chainId, bc.chainId)
+	}
+	if loadedGenesis.getId() != g.getId() {
+		t.Fatalf("loaded genesis block %v, want %v", loadedGenesis.getId(), g.getId())
+	}
+}
+
+func TestLoadGenesisRefusesTamperedFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(o *genesisJson)
+	}{
+		{"chain ID changed", func(o *genesisJson) { o.ChainId = strings.Repeat("0", len(o.ChainId)) }},
+		{"balances changed", func(o *genesisJson) { o.Balances["attacker"] = 1000000 }},
+		{"settings changed", func(o *genesisJson) { o.Config = json.RawMessage(`{"powLeadingZeroes": 2}`) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, _ := writeTestGenesis(t, testBlockChain(t))
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var o genesisJson
+			if err := json.Unmarshal(data, &o); err != nil {
+				t.Fatal(err)
+			}
+			test.tamper(&o)
+			if data, err = json.Marshal(o); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, _, err := LoadGenesis(path); !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("got %v, want ErrInvalidConfig", err)
+			}
+		})
+	}
+}
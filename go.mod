@@ -2,4 +2,8 @@ module SpartanGold
 
 go 1.18
 
-require github.com/chuckpreslar/emission v0.0.0-20170206194824-a7ddd980baf9 // indirect
+require (
+	github.com/chuckpreslar/emission v0.0.0-20170206194824-a7ddd980baf9
+	github.com/tyler-smith/go-bip39 v1.1.0
+	golang.org/x/crypto v0.17.0
+)
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"testing"
+)
+
+/**
+ * Returns a blockchain that is quick to mine, with no difficulty
+ * adjustment, so that tests can mine blocks as they need them.
+ */
+func testBlockChain(t *testing.T) *BlockChain {
+	t.Helper()
+	cfg := DefaultCfg()
+	cfg.powLeadingZeroes = 1
+	cfg.retargetInterval = 0
+	bc, err := NewBlockChain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+// The gold that fundedGenesis gives each key.
+const TEST_FUNDS = 1000
+
+/**
+ * Makes a genesis block for the blockchain that gives TEST_FUNDS gold to each key.
+ */
+func fundedGenesis(t *testing.T, bc *BlockChain, keys ...*utils.PrivateKey) *Block {
+	t.Helper()
+	balances := make(map[string]int)
+	for _, key := range keys {
+		balances[utils.CalcAddress(key.Public())] = TEST_FUNDS
+	}
+	g, err := bc.makeGenesis(nil, balances)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+/**
+ * Returns a fresh copy of a block, as a client would get it from the network.
+ */
+func copyBlock(t *testing.T, bc *BlockChain, b *Block) *Block {
+	t.Helper()
+	block := bc.deserializeBlock(b.toJson())
+	if block == nil {
+		t.Fatalf("could not copy block %v", b.getId())
+	}
+	return block
+}
+
+/**
+ * Finds a proof for a block, without waiting for the miner's mining rounds.
+ */
+func solve(b *Block) *Block {
+	for !b.hasValidProof() {
+		b.Proof++
+	}
+	return b
+}
+
+/**
+ * Has the miner mine a block from its mempool, and gives a copy of the block
+ * to the miner and to each of the clients, as if it had been broadcast.
+ *
+ * @returns {Block} - The block that was mined.
+ */
+func mineBlock(t *testing.T, m *Miner, clients ...*Client) *Block {
+	t.Helper()
+	m.startNewSearch(nil)
+	block := solve(m.CurrentBlock)
+	bc := m.MClient.blockChain
+	if _, err := m.receiveBlock(copyBlock(t, bc, block)); err != nil {
+		t.Fatalf("miner refused its own block: %v", err)
+	}
+	for _, c := range clients {
+		if _, err := c.receiveBlock(copyBlock(t, bc, block)); err != nil {
+			t.Fatalf("%v refused block: %v", c.name, err)
+		}
+	}
+	return block
+}
+
+/**
+ * Returns a payment signed by the holder of key, paying the default fee.
+ */
+func signedPayment(key *utils.PrivateKey, nonce int, to string, amount int) *Transaction {
+	tx := NewTransaction(utils.CalcAddress(key.Public()), nonce, key.Public(), nil, DEFAULT_TX_FEE, map[string]int{to: amount}, "")
+	tx.sign(key)
+	return tx
+}
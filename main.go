@@ -1,26 +1,64 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 )
 
+// The environment variable holding the keystore passphrase, so that
+// it does not show up in the process list as a flag would.
+const PASSPHRASE_ENV = "SPARTANGOLD_PASSPHRASE"
+
 func main() {
+	name := flag.String("name", "Miner", "name of the miner when running over TCP")
+	connection := flag.String("tcp", "", "host:port to listen on; runs a single TCP miner instead of the simulation")
+	peers := flag.String("peers", "", "comma-separated host:port of other TCP miners")
+	blocksPath := flag.String("blocks", "", "file to keep a TCP miner's blocks in across restarts")
+	genesisPath := flag.String("genesis", "genesis.json", "genesis file shared by every TCP miner; created if it does not exist")
+	keystorePath := flag.String("keystore", "", "encrypted file to keep a TCP miner's keys in across restarts; the passphrase is read from $"+PASSPHRASE_ENV)
+	chainSpec := flag.String("chainspec", "", "JSON file with the blockchain settings, used by the simulation and when creating a genesis file; defaults are used if empty")
+	flag.Parse()
+
+	cfg := DefaultCfg()
+	if *chainSpec != "" {
+		var err error
+		if cfg, err = LoadCfg(*chainSpec); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
+	if *connection != "" {
+		peerList := []string{}
+		if *peers != "" {
+			peerList = strings.Split(*peers, ",")
+		}
+		runTcpMiner(*name, *connection, peerList, *blocksPath, *genesisPath, cfg, *keystorePath, os.Getenv(PASSPHRASE_ENV))
+		return
+	}
+
 	fmt.Println("Starting simulation.  This may take a moment...")
 
 	fakeNet := NewFakeNet()
 
+	bc, err := NewBlockChain(cfg)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
 	//Clients
-	Alice := NewClient("Alice", fakeNet, nil)
-	Bob := NewClient("Bob", fakeNet, nil)
-	Charlie := NewClient("Charlie", fakeNet, nil)
+	Alice := NewClient("Alice", fakeNet, bc, nil)
+	Bob := NewClient("Bob", fakeNet, bc, nil)
+	Charlie := NewClient("Charlie", fakeNet, bc, nil)
 	//Miners
-	Minnie := NewMiner("Minnie", fakeNet, nil)
-	Mickey := NewMiner("Mickey", fakeNet, nil)
+	Minnie := NewMiner("Minnie", fakeNet, bc, nil)
+	Mickey := NewMiner("Mickey", fakeNet, bc, nil)
 
 	// Creating genesis block
-	bc := BlockChain{}
-
 	clientBalanceMap := make(map[*Client]int)
 	clientBalanceMap[Alice] = 233
 	clientBalanceMap[Bob] = 99
@@ -28,8 +66,12 @@ func main() {
 	clientBalanceMap[Minnie.MClient] = 400
 	clientBalanceMap[Mickey.MClient] = 300
 
-	g := bc.makeGenesis(clientBalanceMap, nil)
-	fmt.Println("Serialize: %v", g.serialize())
+	g, err := bc.makeGenesis(clientBalanceMap, nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Serialize: %v\n", g.serialize())
 
 	showBalances := func(client Client) {
 		/*fmt.Printf("Alice has  %v gold.\n", Alice.showAllBalances)
@@ -60,7 +102,9 @@ func main() {
 	// Alice transfers some money to Bob.
 	// Alice aso transfer some money to Charlie
 	fmt.Printf("Alice is transfering 40 gold to Bob- %v and 30 gold to Charlie-%v.\n", Bob.address, Charlie.address)
-	Alice.postTransaction(map[string]int{Bob.address: 40, Charlie.address: 30}, 3)
+	if _, err := Alice.postTransaction(map[string]int{Bob.address: 40, Charlie.address: 30}, 3); err != nil {
+		fmt.Println(err)
+	}
 	time.Sleep(7 * time.Second)
 	fmt.Println()
 	fmt.Printf("Minnie has a chain of length %v:", Minnie.MClient.lastBlock.ChainLength)
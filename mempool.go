@@ -0,0 +1,235 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+/**
+ * A transaction waiting in the mempool, along with its serialized size,
+ * which is used to rank transactions by fee rate.
+ */
+type mempoolEntry struct {
+	tx   *Transaction
+	size int
+}
+
+/**
+ * The transactions a miner knows about that have not been accepted yet.
+ * Transactions are kept once per ID and indexed by sender and nonce, so that
+ * a transaction that arrives before an earlier one from the same sender waits
+ * until the earlier one has been added to a block.
+ */
+type Mempool struct {
+	entries  map[string]*mempoolEntry
+	bySender map[string]map[int]*mempoolEntry
+	maxSize  int
+	mu       sync.Mutex
+}
+
+/**
+ * Creates an empty mempool.
+ *
+ * @param maxSize - The most transactions to keep.  Once full, the
+ *    transactions with the lowest fee rate are evicted first.
+ */
+func NewMempool(maxSize int) *Mempool {
+	var mp Mempool
+	mp.entries = make(map[string]*mempoolEntry)
+	mp.bySender = make(map[string]map[int]*mempoolEntry)
+	mp.maxSize = maxSize
+	return &mp
+}
+
+/**
+ * Adds a transaction to the mempool.  A transaction with the same sender and
+ * nonce as one already waiting replaces it only if it pays a higher fee.
+ *
+ * @param tx - The transaction to add.
+ *
+ * @returns {Boolean} - True if the transaction is now in the mempool.
+ */
+func (mp *Mempool) add(tx *Transaction) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if _, ok := mp.entries[tx.getId()]; ok {
+		return false
+	}
+	if other, ok := mp.bySender[tx.from][tx.nonce]; ok {
+		if other.tx.fee >= tx.fee {
+			return false
+		}
+		mp.remove(other)
+	}
+
+	txJson, err := tx.MarshalJSON()
+	if err != nil {
+		return false
+	}
+	entry := &mempoolEntry{tx, len(txJson)}
+	mp.entries[tx.getId()] = entry
+	byNonce, ok := mp.bySender[tx.from]
+	if !ok {
+		byNonce = make(map[int]*mempoolEntry)
+		mp.bySender[tx.from] = byNonce
+	}
+	byNonce[tx.nonce] = entry
+
+	for len(mp.entries) > mp.maxSize {
+		mp.remove(mp.lowestFeeRate())
+	}
+	_, kept := mp.entries[tx.getId()]
+	return kept
+}
+
+/**
+ * Removes an entry.  The caller must hold mp.mu.
+ */
+func (mp *Mempool) remove(entry *mempoolEntry) {
+	delete(mp.entries, entry.tx.getId())
+	byNonce := mp.bySender[entry.tx.from]
+	delete(byNonce, entry.tx.nonce)
+	if len(byNonce) == 0 {
+		delete(mp.bySender, entry.tx.from)
+	}
+}
+
+/**
+ * Finds the entry to evict when the mempool is full: the one with the
+ * lowest fee rate among each sender's last transaction, since evicting
+ * any earlier one would leave the sender's later transactions stuck.
+ * The caller must hold mp.mu.
+ */
+func (mp *Mempool) lowestFeeRate() *mempoolEntry {
+	var lowest *mempoolEntry
+	for _, byNonce := range mp.bySender {
+		var last *mempoolEntry
+		for _, entry := range byNonce {
+			if last == nil || entry.tx.nonce > last.tx.nonce {
+				last = entry
+			}
+		}
+		if lowest == nil || lowest.hasHigherFeeRate(last) {
+			lowest = last
+		}
+	}
+	return lowest
+}
+
+/**
+ * Compares fee rates, in gold per byte, breaking ties by ID so
+ * that every miner ranks transactions the same way.
+ */
+func (e *mempoolEntry) hasHigherFeeRate(other *mempoolEntry) bool {
+	mine, theirs := e.tx.fee*other.size, other.tx.fee*e.size
+	if mine != theirs {
+		return mine > theirs
+	}
+	return e.tx.getId() < other.tx.getId()
+}
+
+/**
+ * Drops every transaction that the block has made obsolete: those it
+ * contains, and those whose nonce has been used by the block or one
+ * of its ancestors.
+ *
+ * @param block - The newly accepted head of the blockchain.
+ */
+func (mp *Mempool) evictFor(block *Block) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	for _, entry := range mp.entries {
+		if block.contains(entry.tx) || entry.tx.nonce < block.NextNonce[entry.tx.from] {
+			mp.remove(entry)
+		}
+	}
+}
+
+/**
+ * Tracks the serialized size of a block as transactions are added to it, so
+ * that the block does not have to be serialized again for every transaction.
+ */
+type blockSpace struct {
+	maxTransactions int
+	maxSize         int
+	size            int
+}
+
+/**
+ * Measures a block that transactions will be added to.  Every transaction
+ * added to the block afterwards must be added through Mempool.fill.
+ *
+ * @param maxTransactions - The most transactions the block may hold.
+ * @param maxSize - The most bytes the serialized block may take.
+ */
+func newBlockSpace(block *Block, maxTransactions int, maxSize int) *blockSpace {
+	return &blockSpace{maxTransactions, maxSize, len(block.toJson())}
+}
+
+/**
+ * The number of bytes that adding the entry would add to the serialized block:
+ * the transaction, the comma before it, and any digits its fee adds to the
+ * amount of the coinbase transaction.
+ */
+func (s *blockSpace) growth(block *Block, entry *mempoolEntry) int {
+	growth := entry.size + 1
+	if block.Coinbase != nil {
+		amount := block.Coinbase.outputs[block.RewardAddr]
+		growth += len(strconv.Itoa(amount+entry.tx.fee)) - len(strconv.Itoa(amount))
+	}
+	return growth
+}
+
+/**
+ * Determines whether the entry can be added to the block without breaking
+ * the limits on the number of transactions or the size of a block.
+ */
+func (s *blockSpace) fits(block *Block, entry *mempoolEntry) bool {
+	return len(block.Transactions) < s.maxTransactions && s.size+s.growth(block, entry) <= s.maxSize
+}
+
+/**
+ * Adds waiting transactions to a block, highest fee rate first, while
+ * keeping each sender's transactions in nonce order.  A sender whose next
+ * transaction cannot be added is skipped for the rest of the block.
+ *
+ * @param block - The block to add transactions to.
+ * @param space - The room left in the block, which is updated as transactions are added.
+ */
+func (mp *Mempool) fill(block *Block, space *blockSpace) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	skipped := make(map[string]bool)
+	for {
+		var best *mempoolEntry
+		for from, byNonce := range mp.bySender {
+			if skipped[from] {
+				continue
+			}
+			next, ok := byNonce[block.NextNonce[from]]
+			if ok && (best == nil || next.hasHigherFeeRate(best)) {
+				best = next
+			}
+		}
+		if best == nil {
+			return
+		}
+		if !space.fits(block, best) || block.checkTransaction(best.tx) != nil {
+			skipped[best.tx.from] = true
+			continue
+		}
+		space.size += space.growth(block, best)
+		block.addTransaction(best.tx, nil)
+	}
+}
+
+/**
+ * Returns the number of waiting transactions.
+ */
+func (mp *Mempool) size() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return len(mp.entries)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"testing"
+)
+
+func TestFillTracksBlockSize(t *testing.T) {
+	bc := testBlockChain(t)
+	keys := []*utils.PrivateKey{}
+	for i := 0; i < 5; i++ {
+		keys = append(keys, utils.GenerateKeypair())
+	}
+	g := fundedGenesis(t, bc, keys...)
+
+	mp := NewMempool(MEMPOOL_MAX_TRANSACTIONS)
+	for nonce := 0; nonce < 10; nonce++ {
+		for _, key := range keys {
+			// Fees large enough to add digits to the coinbase amount.
+			tx := NewTransaction(utils.CalcAddress(key.Public()), nonce, key.Public(), nil, 7, map[string]int{"payee": 1}, "")
+			tx.sign(key)
+			mp.add(tx)
+		}
+	}
+
+	for _, maxSize := range []int{MAX_BLOCK_SIZE, 10000} {
+		block := bc.makeBlock("miner", g, nil, nil)
+		space := newBlockSpace(block, MAX_BLOCK_TRANSACTIONS, maxSize)
+		mp.fill(block, space)
+		size := len(block.toJson())
+		if space.size != size {
+			t.Fatalf("tracked size is %v, but the block is %v bytes", space.size, size)
+		}
+		if size > maxSize {
+			t.Fatalf("block is %v bytes, but at most %v are allowed", size, maxSize)
+		}
+		if maxSize < MAX_BLOCK_SIZE && len(block.Transactions) == mp.size() {
+			t.Fatal("every transaction fit, so the size limit was not tested")
+		}
+	}
+}
+
+/**
+ * Returns a payment of 1 gold signed by the holder of key, paying the specified fee.
+ */
+func paymentWithFee(key *utils.PrivateKey, nonce int, fee int) *Transaction {
+	tx := NewTransaction(utils.CalcAddress(key.Public()), nonce, key.Public(), nil, fee, map[string]int{"payee": 1}, "")
+	tx.sign(key)
+	return tx
+}
+
+/**
+ * Returns the IDs of the transactions waiting in the mempool.
+ */
+func waiting(mp *Mempool) map[string]bool {
+	ids := make(map[string]bool)
+	for id := range mp.entries {
+		ids[id] = true
+	}
+	return ids
+}
+
+func TestAddKeepsOneTransactionPerIdAndNonce(t *testing.T) {
+	key := utils.GenerateKeypair()
+	mp := NewMempool(MEMPOOL_MAX_TRANSACTIONS)
+	tx := paymentWithFee(key, 0, 2)
+
+	if !mp.add(tx) {
+		t.Fatal("transaction refused by an empty mempool")
+	}
+	if mp.add(tx) || mp.add(paymentWithFee(key, 0, 2)) {
+		t.Fatal("added a second transaction with the same sender and nonce, but no higher fee")
+	}
+	if mp.size() != 1 {
+		t.Fatalf("mempool holds %v transactions, want 1", mp.size())
+	}
+
+	higher := paymentWithFee(key, 0, 3)
+	if !mp.add(higher) {
+		t.Fatal("transaction with a higher fee did not replace the waiting one")
+	}
+	if ids := waiting(mp); len(ids) != 1 || !ids[higher.getId()] {
+		t.Fatalf("mempool holds %v, want only the transaction with the higher fee", ids)
+	}
+}
+
+func TestFillOrdersByFeeRateKeepingNonceOrder(t *testing.T) {
+	bc := testBlockChain(t)
+	alice, bob := utils.GenerateKeypair(), utils.GenerateKeypair()
+	g := fundedGenesis(t, bc, alice, bob)
+
+	// Alice's second transaction pays the most, but it cannot be
+	// added before her first, which pays the least.
+	a0, a1 := paymentWithFee(alice, 0, 1), paymentWithFee(alice, 1, 9)
+	b0, b1 := paymentWithFee(bob, 0, 5), paymentWithFee(bob, 1, 3)
+	mp := NewMempool(MEMPOOL_MAX_TRANSACTIONS)
+	for _, tx := range []*Transaction{a1, b1, a0, b0} {
+		if !mp.add(tx) {
+			t.Fatalf("transaction %v refused", tx.getId())
+		}
+	}
+
+	// Allowing one more transaction in each block shows which one is added next.
+	order := []*Transaction{b0, b1, a0, a1}
+	for n := 1; n <= len(order); n++ {
+		block := bc.makeBlock("miner", g, nil, nil)
+		mp.fill(block, newBlockSpace(block, n, MAX_BLOCK_SIZE))
+		if len(block.Transactions) != n {
+			t.Fatalf("block has %v transactions, want %v", len(block.Transactions), n)
+		}
+		for i, tx := range order[:n] {
+			if !block.contains(tx) {
+				t.Fatalf("block of %v transactions is missing transaction %v in the expected order", n, i)
+			}
+		}
+	}
+}
+
+func TestAddEvictsLowestFeeRateWhenFull(t *testing.T) {
+	alice, bob, carol := utils.GenerateKeypair(), utils.GenerateKeypair(), utils.GenerateKeypair()
+	a0, a1 := paymentWithFee(alice, 0, 1), paymentWithFee(alice, 1, 9)
+	b0 := paymentWithFee(bob, 0, 5)
+	mp := NewMempool(3)
+	for _, tx := range []*Transaction{a0, a1, b0} {
+		if !mp.add(tx) {
+			t.Fatalf("transaction %v refused", tx.getId())
+		}
+	}
+
+	// Alice's first transaction has the lowest fee, but evicting it
+	// would leave her second stuck, so Bob's is evicted instead.
+	c0 := paymentWithFee(carol, 0, 6)
+	if !mp.add(c0) {
+		t.Fatal("transaction with a higher fee rate refused by a full mempool")
+	}
+	ids := waiting(mp)
+	if len(ids) != 3 || ids[b0.getId()] || !ids[a0.getId()] {
+		t.Fatalf("mempool holds %v, want Bob's transaction evicted", ids)
+	}
+
+	// A transaction that would itself be the lowest is not kept.
+	if mp.add(paymentWithFee(bob, 0, 2)) {
+		t.Fatal("transaction with the lowest fee rate added to a full mempool")
+	}
+	if mp.size() != 3 {
+		t.Fatalf("mempool holds %v transactions, want 3", mp.size())
+	}
+}
+
+func TestEvictForDropsTransactionsTheBlockMadeObsolete(t *testing.T) {
+	bc := testBlockChain(t)
+	alice, bob := utils.GenerateKeypair(), utils.GenerateKeypair()
+	g := fundedGenesis(t, bc, alice, bob)
+
+	a0, a1 := paymentWithFee(alice, 0, 1), paymentWithFee(alice, 1, 1)
+	b0, b1 := paymentWithFee(bob, 0, 1), paymentWithFee(bob, 1, 1)
+	mp := NewMempool(MEMPOOL_MAX_TRANSACTIONS)
+	for _, tx := range []*Transaction{a0, a1, b0, b1} {
+		mp.add(tx)
+	}
+
+	// The block contains Bob's first transaction, and a different
+	// transaction using Alice's first nonce.
+	block := bc.makeBlock("miner", g, nil, nil)
+	for _, tx := range []*Transaction{b0, paymentWithFee(alice, 0, 4)} {
+		if err := block.addTransaction(tx, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mp.evictFor(block)
+
+	ids := waiting(mp)
+	if len(ids) != 2 || !ids[a1.getId()] || !ids[b1.getId()] {
+		t.Fatalf("mempool holds %v, want only the second transaction from each sender", ids)
+	}
+}
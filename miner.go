@@ -1,32 +1,60 @@
 package main
 
 import (
-	"errors"
+	"SpartanGold/utils"
 	"fmt"
 	"time"
 )
 
 type Miner struct {
+	// Number of proofs to try before checking for messages.  If not set
+	// before the miner is initialized, it is taken from the blockchain settings.
 	MiningRounds int
 	MClient      *Client
 	CurrentBlock *Block
-	Transactions []*Transaction
+	Mempool      *Mempool
+	// The room left in CurrentBlock.
+	space *blockSpace
 }
 
-func NewMiner(name string, net *fake_net, startingBlock *Block) *Miner {
+/**
+ * Creates a miner that keeps its blocks in memory.
+ *
+ * @param bc - The blockchain settings, as for NewClientWithStore.
+ * @param startingBlock - The genesis block, if it has been made already.
+ */
+func NewMiner(name string, net Network, bc *BlockChain, startingBlock *Block) *Miner {
+	// An empty store is never refused.
+	m, _ := NewMinerWithStore(name, net, bc, startingBlock, NewMemoryBlockStore(), nil)
+	return m
+}
+
+/**
+ * Creates a miner that keeps its blocks in the specified store.
+ *
+ * @param key - The miner's key pair, or nil to generate a new one.
+ *
+ * @returns {Miner} - The miner, or ErrWrongGenesis as for NewClientWithStore.
+ */
+func NewMinerWithStore(name string, net Network, bc *BlockChain, startingBlock *Block, store BlockStore, key *utils.PrivateKey) (*Miner, error) {
 	var m Miner
-	asClient := NewClient(name, net, startingBlock) //super
+	asClient, err := NewClientWithStore(name, net, bc, startingBlock, store, key) //super
+	if err != nil {
+		return nil, err
+	}
 	m.MClient = asClient
-	m.MiningRounds = NUM_ROUNDS_MINING
-	m.Transactions = []*Transaction{}
+	m.Mempool = NewMempool(MEMPOOL_MAX_TRANSACTIONS)
 
-	return &m
+	return &m, nil
 }
 
 /**
  * Starts listeners and begins mining.
  */
 func (m *Miner) initialize() {
+	if m.MiningRounds == 0 {
+		m.MiningRounds = m.MClient.blockChain.cfg.miningRounds
+	}
 	m.startNewSearch(nil)
 
 	m.MClient.emitter.On(START_MINING, m.findProof)
@@ -35,7 +63,7 @@ func (m *Miner) initialize() {
 	m.MClient.emitter.On(PROOF_FOUND, m.receiveBlock)
 
 	time.Sleep(0 * time.Second)
-	m.MClient.emitter.Emit(START_MINING)
+	m.MClient.deliver(START_MINING)
 
 }
 
@@ -45,20 +73,21 @@ func (m *Miner) initialize() {
  * @param {Set} [txSet] - Transactions the miner has that have not been accepted yet.
  */
 func (m *Miner) startNewSearch(txSet map[*Transaction]int) {
-	m.CurrentBlock = m.MClient.blockChain.makeBlock(m.MClient.address, m.MClient.lastBlock, nil, nil) //i,c set in makeBlock
-	// Merging txSet into the transaction queue.
+	bc := m.MClient.blockChain
+	target := bc.expectedTarget(m.MClient.lastBlock, m.MClient.chain)
+	m.CurrentBlock = bc.makeBlock(m.MClient.address, m.MClient.lastBlock, target, nil) //c set in makeBlock
+	m.space = newBlockSpace(m.CurrentBlock, bc.cfg.maxBlockTransactions, bc.cfg.maxBlockSize)
+	// Merging txSet into the mempool.
 	// These transactions may include transactions not already included
 	// by a recently received block, but that the miner is aware of.
-	for tx, _ := range txSet {
-		m.Transactions = append(m.Transactions, tx)
-		m.addTransaction(tx)
+	for tx := range txSet {
+		m.Mempool.add(tx)
 	}
 
-	// Add queued-up transactions to block.
-	//for _, tx := range m.Transactions {
-	//	m.CurrentBlock.addTransaction(tx, nil)
-	//}
-	m.Transactions = []*Transaction{} //clear
+	// Drop anything the new chain has already accepted, then fill
+	// the block with the best-paying transactions that remain.
+	m.Mempool.evictFor(m.MClient.lastBlock)
+	m.Mempool.fill(m.CurrentBlock, m.space)
 
 	// Start looking for a proof at 0.
 	m.CurrentBlock.Proof = 0
@@ -79,127 +108,160 @@ func (m *Miner) findProof() {
 	for m.CurrentBlock.Proof < pausePoint {
 		if m.CurrentBlock.hasValidProof() {
 			fmt.Printf("%v found proof for block %v : %v \n", m.MClient.name, m.CurrentBlock.ChainLength, m.CurrentBlock.Proof)
-			go m.announceProof()
-			// Note: calling receiveBlock triggers a new search.
-			//m.receiveBlock(m.CurrentBlock)
-			m.startNewSearch(nil)
+			// The broadcast reaches this miner as well, and
+			// receiving the block triggers a new search.
+			m.announceProof()
 			break
 		}
 		m.CurrentBlock.Proof++
 	}
-	m.MClient.emitter.Emit(START_MINING)
+	// Queued behind any messages that arrived during this round,
+	// so that they are handled before mining continues.
+	m.MClient.deliver(START_MINING)
 }
 
 /**
  * Broadcast the block, with a valid proof included.
  */
 func (m *Miner) announceProof() {
-	m.MClient.net.broadcast(PROOF_FOUND, m.CurrentBlock)
+	m.MClient.net.broadcast(m.MClient.address, PROOF_FOUND, m.CurrentBlock)
 }
 
 /**
  * Receives a block from another miner. If it is valid,
- * the block will be stored. If it is also a longer chain,
- * the miner will accept it and replace the currentBlock.
+ * the block will be stored. If its chain has more work than
+ * the current one, the miner will accept it and replace the currentBlock.
  *
  * @param {Block | Object} b - The block
  */
-func (m *Miner) receiveBlock(b *Block) *Block {
-	block := m.MClient.receiveBlock(b)
-	if block == nil {
-		errors.New("The block is invalid block")
-		return nil
+func (m *Miner) receiveBlock(b *Block) (*Block, error) {
+	head := m.MClient.lastBlock
+	block, err := m.MClient.receiveBlock(b)
+	if err != nil {
+		return nil, err
 	}
 
-	// We switch over to the new chain only if it is better.
-	if m.CurrentBlock != nil && block.ChainLength >= m.CurrentBlock.ChainLength {
+	// We switch over to the new chain only if it is better, in which case
+	// the client has made it (or a block that it unstuck) the new head.
+	if m.CurrentBlock != nil && m.MClient.lastBlock != head {
 		fmt.Println("cutting over to new chain")
-		txSet := m.syncTransactions(block)
+		txSet := m.syncTransactions(m.MClient.lastBlock)
 		m.startNewSearch(txSet)
 	}
-	return block
+	return block, nil
 }
 
 /**
- * This function should determine what transactions
- * need to be added or deleted.  It should find a common ancestor (retrieving
- * any transactions from the rolled-back blocks), remove any transactions
- * already included in the newly accepted blocks, and add any remaining
- * transactions to the new block.
+ * Determines which transactions need to go back into the mempool when the
+ * miner switches to a new chain.  It finds the common ancestor of the new
+ * block and the block being mined, collects the transactions from the
+ * rolled-back blocks, and removes any that the new chain already includes.
+ * Blocks on either branch are looked up by height in the chain index.
+ * Transactions are matched by ID, since blocks received from the network
+ * hold their own copies of each transaction.
  *
  * @param {Block} nb - The newly accepted block.
  *
  * @returns {Set} - The set of transactions that have not yet been accepted by the new block.
  */
 func (m *Miner) syncTransactions(nb *Block) map[*Transaction]int {
+	chain := m.MClient.chain
 	cb := m.CurrentBlock
-	cbTxs := make(map[*Transaction]int)
-	nbTxs := make(map[*Transaction]int)
-
-	// The new block may be ahead of the old block.  We roll back the new chain
-	// to the matching height, collecting any transactions.
-	for nb.ChainLength > cb.ChainLength {
-		for _, tx := range nb.Transactions {
-			nbTxs[tx] = 0 //add
-			nb = m.MClient.blocks[string(nb.PrevBlockHash)]
+	cbTxs := make(map[string]*Transaction)
+	nbTxs := make(map[string]bool)
+
+	rollBackOld := func(block *Block) {
+		for id, tx := range block.Transactions {
+			cbTxs[id] = tx
+		}
+	}
+	rollBackNew := func(block *Block) {
+		for id := range block.Transactions {
+			nbTxs[id] = true
 		}
 	}
 
-	// Step back in sync until we hit the common ancestor.
-	for cb != nil && nb != nil && cb.getId() != nb.getId() {
-		// Store any transactions in the two chains.
-		for _, tx := range cb.Transactions {
-			cbTxs[tx] = 0
+	// Either chain may be ahead of the other.  We roll back whichever is
+	// longer to the matching height, collecting any transactions.
+	height := cb.ChainLength
+	if nb.ChainLength < height {
+		height = nb.ChainLength
+	}
+	for h := nb.ChainLength; h > height; h-- {
+		if block := chain.ancestor(nb, h); block != nil {
+			rollBackNew(block)
 		}
-		for _, tx := range nb.Transactions {
-			nbTxs[tx] = 0
+	}
+	for h := cb.ChainLength; h > height; h-- {
+		if block := chain.ancestor(cb, h); block != nil {
+			rollBackOld(block)
 		}
-		cb = m.MClient.blocks[string(cb.PrevBlockHash)]
-		nb = m.MClient.blocks[string(nb.PrevBlockHash)]
+	}
 
+	// Step back in sync until we hit the common ancestor.
+	for ; height >= 0; height-- {
+		oldBlock, newBlock := chain.ancestor(cb, height), chain.ancestor(nb, height)
+		if oldBlock == nil || newBlock == nil || oldBlock.getId() == newBlock.getId() {
+			break
+		}
+		rollBackOld(oldBlock)
+		rollBackNew(newBlock)
 	}
 
 	// Remove all transactions that the new chain already has.
-	//	fmt.Printf("BLOCK nb IN syncTransactions  (miner.go) - %v \n", nb.getId())
-	//	fmt.Printf("LENGTH OF nb.Transactions (syncTransactions - miner.go) - %v \n", len(nb.Transactions))
-	if len(nbTxs) != 0 { //keep getting error here
-		for tx := range nbTxs {
-			if _, ok := cbTxs[tx]; ok { //if currentBlocks has tx from new chain, delete it
-				delete(cbTxs, tx)
-			}
+	txSet := make(map[*Transaction]int)
+	for id, tx := range cbTxs {
+		if !nbTxs[id] {
+			txSet[tx] = 0
 		}
 	}
-	return cbTxs
+	return txSet
 }
 
 /**
  * Returns false if transaction is not accepted. Otherwise stores
- * the transaction to be added to the next block.
+ * the transaction in the mempool, and adds it to the current block
+ * if it is next in line for its sender.
  *
- * @param {Transaction | String} tx - The transaction to add.
+ * @param {Transaction | String} tx - The transaction to add, either as a
+ *    *Transaction or as the JSON bytes received from the network.
  */
-func (m *Miner) addTransaction(tx *Transaction) bool {
-	var addingtx *Transaction
-	if tx == nil {
-		addingtx = makeTransaction(tx) //need to fix makeTransaction in blockchain.go
-	} else {
-		addingtx = tx
-	}
-	m.Transactions = append(m.Transactions, addingtx)
-	return m.CurrentBlock.addTransaction(addingtx, nil)
+func (m *Miner) addTransaction(o interface{}) bool {
+	tx := makeTransaction(o)
+	if tx == nil || !tx.validSignature() {
+		return false
+	}
+	// Transactions whose nonce has already been used can never be added.
+	if tx.nonce < m.MClient.lastBlock.NextNonce[tx.from] {
+		return false
+	}
+	if !m.Mempool.add(tx) {
+		return false
+	}
+	// Before mining starts, the transaction waits for the first search.
+	if m.CurrentBlock != nil {
+		m.Mempool.fill(m.CurrentBlock, m.space)
+	}
+	return true
 }
 
 /**
  * When a miner posts a transaction, it must also add it to its current list of transactions.
  *
  * @param  {...any} args - Arguments needed for Client.postTransaction.
+ *
+ * @returns Transaction - The posted transaction, or the error from Client.postTransaction.
  */
-func (m *Miner) postTransaction(outputs map[string]int, fee int) bool {
+func (m *Miner) postTransaction(outputs map[string]int, fee int) (*Transaction, error) {
 	//println("IN POST TRANSACTION miner.go")
-	f := DEFAULT_TX_FEE
-	if fee > DEFAULT_TX_FEE {
+	f := m.MClient.blockChain.cfg.defaultTxFee
+	if fee > f {
 		f = fee
 	}
-	tx := m.MClient.postTransaction(outputs, f)
-	return m.addTransaction(tx)
+	tx, err := m.MClient.postTransaction(outputs, f)
+	if err != nil {
+		return nil, err
+	}
+	m.addTransaction(tx)
+	return tx, nil
 }
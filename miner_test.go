@@ -0,0 +1,126 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"testing"
+)
+
+func TestMinerHoldsTransactionUntilEarlierNonceLands(t *testing.T) {
+	bc := testBlockChain(t)
+	key := utils.GenerateKeypair()
+	g := fundedGenesis(t, bc, key)
+	m := NewMiner("Miner", NewFakeNet(), bc, g)
+
+	second := signedPayment(key, 1, "payee", 20)
+	if !m.addTransaction(second) {
+		t.Fatal("miner refused a transaction whose earlier nonce has not arrived yet")
+	}
+	if block := mineBlock(t, m); block.contains(second) {
+		t.Fatal("transaction was mined before the transaction with the earlier nonce")
+	}
+	if m.Mempool.size() != 1 {
+		t.Fatalf("mempool has %v transactions, want the held one", m.Mempool.size())
+	}
+
+	first := signedPayment(key, 0, "payee", 10)
+	if !m.addTransaction(first) {
+		t.Fatal("miner refused the transaction with the earlier nonce")
+	}
+	block := mineBlock(t, m)
+	if !block.contains(first) || !block.contains(second) {
+		t.Fatal("block does not contain both transactions")
+	}
+	if balance := m.MClient.lastBlock.balanceOf("payee"); balance != 30 {
+		t.Fatalf("payee has %v gold, want 30", balance)
+	}
+}
+
+/**
+ * Returns the IDs of the transactions in a set returned by Miner.syncTransactions.
+ */
+func txIds(txSet map[*Transaction]int) map[string]bool {
+	ids := make(map[string]bool)
+	for tx := range txSet {
+		ids[tx.getId()] = true
+	}
+	return ids
+}
+
+/**
+ * Sets up a reorg: the miner mines a branch of two blocks, then receives a
+ * heavier branch of three blocks that was mined elsewhere.  Both branches
+ * include txA0; only the old branch includes txB0, and txA1 is waiting
+ * in the block the miner was working on.
+ */
+func reorgFixture(t *testing.T) (m *Miner, newBranch []*Block, txA0, txB0, txA1 *Transaction) {
+	t.Helper()
+	bc := testBlockChain(t)
+	keyA, keyB := utils.GenerateKeypair(), utils.GenerateKeypair()
+	g := fundedGenesis(t, bc, keyA, keyB)
+	txA0 = signedPayment(keyA, 0, "payee", 10)
+	txB0 = signedPayment(keyB, 0, "payee", 20)
+	txA1 = signedPayment(keyA, 1, "payee", 30)
+
+	m = NewMiner("Old", NewFakeNet(), bc, g)
+	m.addTransaction(txA0)
+	mineBlock(t, m)
+	m.addTransaction(txB0)
+	mineBlock(t, m)
+	m.addTransaction(txA1)
+	if !m.CurrentBlock.contains(txA1) {
+		t.Fatal("txA1 was not added to the block being mined")
+	}
+
+	other := NewMiner("New", NewFakeNet(), bc, g)
+	other.addTransaction(txA0)
+	for i := 0; i < 3; i++ {
+		newBranch = append(newBranch, copyBlock(t, bc, mineBlock(t, other)))
+	}
+	return m, newBranch, txA0, txB0, txA1
+}
+
+func TestSyncTransactionsAfterDeepReorg(t *testing.T) {
+	m, newBranch, txA0, txB0, txA1 := reorgFixture(t)
+
+	// Storing the new branch without switching to it, so that the
+	// orphaned branch is still the active one.
+	for _, block := range newBranch {
+		if err := m.MClient.blocks.put(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requeued := txIds(m.syncTransactions(newBranch[len(newBranch)-1]))
+	if requeued[txA0.getId()] {
+		t.Fatal("txA0 is requeued, but the new branch already includes it")
+	}
+	if !requeued[txB0.getId()] || !requeued[txA1.getId()] || len(requeued) != 2 {
+		t.Fatalf("requeued %v, want txB0 and txA1", requeued)
+	}
+}
+
+func TestMinerRequeuesOrphanedTransactionsAfterDeepReorg(t *testing.T) {
+	m, newBranch, txA0, txB0, txA1 := reorgFixture(t)
+
+	for _, block := range newBranch {
+		if _, err := m.receiveBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	head := newBranch[len(newBranch)-1]
+	if m.MClient.lastBlock.getId() != head.getId() {
+		t.Fatal("miner did not switch to the heavier branch")
+	}
+
+	// txA0 landed on the new branch, so its nonce is used; the other two
+	// are valid on the new branch and go into the next block.
+	if m.CurrentBlock.contains(txA0) {
+		t.Fatal("txA0 would be mined twice")
+	}
+	if !m.CurrentBlock.contains(txB0) || !m.CurrentBlock.contains(txA1) {
+		t.Fatal("orphaned transactions were not requeued into the next block")
+	}
+	if err := m.CurrentBlock.checkTransaction(txA0); err == nil {
+		t.Fatal("txA0 could be replayed on the new branch")
+	}
+}
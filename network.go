@@ -0,0 +1,77 @@
+package main
+
+import "encoding/json"
+
+/**
+ * A Network delivers messages between clients.  fake_net delivers them
+ * within a single process for simulations, while tcpNet sends them to
+ * miners running in other processes.
+ */
+type Network interface {
+	/**
+	 * Registers clients to the network, so that messages can be sent to them.
+	 */
+	register(clientList []*Client)
+
+	/**
+	 * Sends message msg and payload o from the client with address from
+	 * to every client on the network.
+	 */
+	broadcast(from string, msg string, o interface{})
+
+	/**
+	 * Sends message msg and payload o from the client with address from
+	 * to the client with the specified address.
+	 */
+	sendMessage(from string, address string, msg string, o interface{})
+
+	/**
+	 * Tests whether a client is registered with the network.
+	 */
+	recognizes(client Client) bool
+}
+
+/**
+ * Encodes the payload of a network message, as it would be sent over the wire.
+ *
+ * @param o - The payload: a *Block, *Transaction or Message.
+ */
+func encodePayload(o interface{}) ([]byte, error) {
+	if block, ok := o.(*Block); ok {
+		return block.toJson(), nil
+	}
+	return json.Marshal(o)
+}
+
+/**
+ * Decodes the payload of a network message into the type that its listeners
+ * expect.  Blocks are decoded with the receiver's blockchain settings and
+ * still need to be rerun to restore their balances.
+ *
+ * @param msg - The name of the message (e.g. "PROOF_FOUND").
+ * @param data - The payload, as produced by encodePayload.
+ * @param bc - The blockchain of the receiving client.
+ *
+ * @returns - The payload, or nil if it could not be decoded.
+ */
+func decodePayload(msg string, data []byte, bc *BlockChain) interface{} {
+	switch msg {
+	case PROOF_FOUND:
+		if bc == nil {
+			return nil
+		}
+		if block := bc.deserializeBlock(data); block != nil {
+			return block
+		}
+	case POST_TRANSACTION:
+		if tx := makeTransaction(data); tx != nil {
+			return tx
+		}
+	case MISSING_BLOCK:
+		var m Message
+		if err := json.Unmarshal(data, &m); err == nil {
+			return m
+		}
+	}
+	return nil
+}
@@ -1,6 +1,461 @@
 package main
 
+import (
+	"SpartanGold/utils"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Network message sent by a miner to announce itself to a peer.
+const REGISTER = "REGISTER"
+
+// Largest message accepted from a peer, to avoid allocating for a bogus length prefix.
+const MAX_TCP_MESSAGE_SIZE = 16 * 1024 * 1024
+
+// How long to wait when connecting to a peer.
+const TCP_DIAL_TIMEOUT = 5 * time.Second
+
+/**
+ * A Network that connects the clients in this process to miners running in
+ * other processes.  Messages for local clients are delivered in-process,
+ * as with fake_net; messages for remote miners are sent over TCP.
+ */
+type tcpNet struct {
+	connection string
+	blockChain *BlockChain
+	// Clients running in this process, by address.
+	clients map[string]*Client
+	// The host:port of each remote miner, by address.
+	peers    map[string]string
+	mu       sync.RWMutex
+	listener net.Listener
+}
+
+/**
+ * A message as it is sent over a connection.  On the wire each message
+ * is a 4-byte big-endian length followed by this structure in JSON.
+ * Messages from a peer on another blockchain are refused.
+ */
+type tcpMessage struct {
+	ChainId string          `json:"chainId"`
+	Msg     string          `json:"msg"`
+	O       json.RawMessage `json:"o"`
+}
+
+/**
+ * Identifies the clients of one process to its peers.
+ */
+type tcpPeer struct {
+	Addresses  []string `json:"addresses"`
+	Connection string   `json:"connection"`
+}
+
+/**
+ * Creates a network that will listen on the specified connection.
+ *
+ * @param connection - The host:port to listen on, e.g. "localhost:9000".
+ * @param bc - The blockchain settings, used to deserialize received blocks.
+ */
+func NewTcpNet(connection string, bc *BlockChain) *tcpNet {
+	var t tcpNet
+	t.connection = connection
+	t.blockChain = bc
+	t.clients = make(map[string]*Client)
+	t.peers = make(map[string]string)
+	return &t
+}
+
+/**
+ * Registers clients running in this process.
+ */
+func (t *tcpNet) register(clientList []*Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, client := range clientList {
+		t.clients[client.address] = client
+	}
+}
+
+/**
+ * Delivers the message to every local client and sends it to every peer.
+ */
+func (t *tcpNet) broadcast(from string, msg string, o interface{}) {
+	t.mu.RLock()
+	addresses := make([]string, 0, len(t.clients))
+	for address := range t.clients {
+		addresses = append(addresses, address)
+	}
+	connections := make(map[string]bool)
+	for _, connection := range t.peers {
+		connections[connection] = true
+	}
+	t.mu.RUnlock()
+
+	for _, address := range addresses {
+		t.sendMessage(from, address, msg, o)
+	}
+	for connection := range connections {
+		t.send(connection, msg, o)
+	}
+}
+
+/**
+ * Delivers the message to a local client, or sends it to the peer
+ * that the client is running on.
+ */
+func (t *tcpNet) sendMessage(from string, address string, msg string, o interface{}) {
+	t.mu.RLock()
+	client, isLocal := t.clients[address]
+	connection, isPeer := t.peers[address]
+	t.mu.RUnlock()
+
+	if isLocal {
+		client.deliver(msg, o)
+	} else if isPeer {
+		t.send(connection, msg, o)
+	}
+}
+
+/**
+ * Tests whether a client is running in this process or on a known peer.
+ */
+func (t *tcpNet) recognizes(client Client) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, isLocal := t.clients[client.address]
+	_, isPeer := t.peers[client.address]
+	return isLocal || isPeer
+}
+
+/**
+ * Starts accepting connections from other miners.
+ */
+func (t *tcpNet) listen() error {
+	listener, err := net.Listen("tcp", t.connection)
+	if err != nil {
+		return err
+	}
+	t.listener = listener
+	go t.acceptConnections()
+	return nil
+}
+
+/**
+ * Sends the addresses of the local clients to another process, which
+ * registers them and replies in kind if it did not know them yet.
+ *
+ * @param connection - The host:port of the other process.
+ */
+func (t *tcpNet) registerWith(connection string) {
+	t.mu.RLock()
+	me := tcpPeer{[]string{}, t.connection}
+	for address := range t.clients {
+		me.Addresses = append(me.Addresses, address)
+	}
+	t.mu.RUnlock()
+	t.send(connection, REGISTER, me)
+}
+
+func (t *tcpNet) acceptConnections() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go t.handleConnection(conn)
+	}
+}
+
+/**
+ * Reads messages from a peer until it closes the connection.
+ */
+func (t *tcpNet) handleConnection(conn net.Conn) {
+	defer conn.Close()
+	for {
+		data, err := readTcpMessage(conn)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Printf("Dropped connection from %v: %v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		var m tcpMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			fmt.Printf("Received a malformed message from %v: %v\n", conn.RemoteAddr(), err)
+			return
+		}
+		t.receiveMessage(m)
+	}
+}
+
+/**
+ * Decodes a message from a peer and delivers it to every local client.
+ */
+func (t *tcpNet) receiveMessage(m tcpMessage) {
+	if m.ChainId != t.blockChain.chainId {
+		if m.Msg == REGISTER {
+			var p tcpPeer
+			json.Unmarshal(m.O, &p)
+			fmt.Printf("Refused peer %v: it is on chain %v, not %v\n", p.Connection, m.ChainId, t.blockChain.chainId)
+		}
+		return
+	}
+
+	if m.Msg == REGISTER {
+		var p tcpPeer
+		if err := json.Unmarshal(m.O, &p); err == nil && p.Connection != t.connection {
+			t.registerPeer(p)
+		}
+		return
+	}
+
+	o := decodePayload(m.Msg, m.O, t.blockChain)
+	if o == nil {
+		return
+	}
+
+	t.mu.RLock()
+	clients := make([]*Client, 0, len(t.clients))
+	for _, client := range t.clients {
+		clients = append(clients, client)
+	}
+	t.mu.RUnlock()
+	for _, client := range clients {
+		client.deliver(m.Msg, o)
+	}
+}
+
+/**
+ * Records the clients of another process, registering with it
+ * in return if any of them were new.
+ */
+func (t *tcpNet) registerPeer(p tcpPeer) {
+	isNew := false
+	t.mu.Lock()
+	for _, address := range p.Addresses {
+		if _, ok := t.peers[address]; !ok {
+			t.peers[address] = p.Connection
+			isNew = true
+		}
+	}
+	t.mu.Unlock()
+
+	if isNew {
+		fmt.Printf("Registered peer %v\n", p.Connection)
+		t.registerWith(p.Connection)
+	}
+}
+
+/**
+ * Sends a message to a peer, logging rather than returning any failure,
+ * since a peer that has gone away should not stop this process.
+ */
+func (t *tcpNet) send(connection string, msg string, o interface{}) {
+	if err := sendTcpMessage(connection, t.blockChain.chainId, msg, o); err != nil {
+		fmt.Printf("Could not send %v to %v: %v\n", msg, connection, err)
+	}
+}
+
+/**
+ * A miner whose network is a tcpNet.
+ */
 type tcp_miner struct {
-	fake_net
 	Miner
+	network *tcpNet
+}
+
+/**
+ * Creates a miner that will listen on the specified connection.
+ *
+ * @param name - The miner's name, used for logging.
+ * @param connection - The host:port to listen on, e.g. "localhost:9000".
+ * @param bc - The blockchain settings shared by every node.
+ * @param startingBlock - The genesis block, which must be the same for every node.
+ * @param store - Where the miner keeps its blocks.
+ * @param key - The miner's key pair, or nil to generate a new one.
+ *
+ * @returns - The miner, or ErrWrongGenesis if store holds another blockchain.
+ */
+func NewTcpMiner(name string, connection string, bc *BlockChain, startingBlock *Block, store BlockStore, key *utils.PrivateKey) (*tcp_miner, error) {
+	network := NewTcpNet(connection, bc)
+	m, err := NewMinerWithStore(name, network, bc, startingBlock, store, key)
+	if err != nil {
+		return nil, err
+	}
+	network.register([]*Client{m.MClient})
+	return &tcp_miner{*m, network}, nil
+}
+
+/**
+ * Starts listening for other miners, registers with the specified peers,
+ * and begins mining.
+ *
+ * @param peers - The host:port of each miner to connect to.
+ */
+func (tm *tcp_miner) start(peers []string) error {
+	if err := tm.network.listen(); err != nil {
+		return err
+	}
+	for _, peer := range peers {
+		tm.network.registerWith(peer)
+	}
+	go tm.initialize()
+	return nil
+}
+
+/**
+ * Opens a connection to a miner and sends it a single message.
+ *
+ * @param connection - The host:port of the miner.
+ * @param chainId - The ID of the blockchain that the message is about.
+ * @param msg - The name of the message (e.g. "PROOF_FOUND").
+ * @param o - The payload of the message.
+ */
+func sendTcpMessage(connection string, chainId string, msg string, o interface{}) error {
+	payload, err := encodePayload(o)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(tcpMessage{chainId, msg, payload})
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", connection, TCP_DIAL_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return writeTcpMessage(conn, data)
+}
+
+/**
+ * Creates a genesis file with an empty genesis block.
+ */
+func createGenesis(path string, cfg Cfg) (*BlockChain, *Block, error) {
+	bc, err := NewBlockChain(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	g, err := bc.makeGenesis(nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := bc.writeGenesis(path, g); err != nil {
+		return nil, nil, err
+	}
+	return bc, g, nil
+}
+
+func writeTcpMessage(w io.Writer, data []byte) error {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func readTcpMessage(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > MAX_TCP_MESSAGE_SIZE {
+		return nil, errors.New("message too large")
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+/**
+ * Runs a single miner in this process, connected to other miners over TCP.
+ * Every miner must be started from the same genesis file.  If the file does
+ * not exist yet, it is created with an empty genesis block, so miners only
+ * hold gold that they have mined, and can be copied to the other miners.
+ *
+ * @param name - The miner's name.
+ * @param connection - The host:port to listen on.
+ * @param peers - The host:port of each miner to connect to.
+ * @param blocksPath - The file to keep blocks in, so the miner can be
+ *    restarted without resyncing.  Blocks are only kept in memory if empty.
+ * @param genesisPath - The genesis file.
+ * @param cfg - The blockchain settings, used only when creating the genesis file.
+ * @param keystorePath - The file to keep the miner's key pair in, encrypted with
+ *    the passphrase, so the miner keeps its address across restarts.  It is created
+ *    if it does not exist.  A new key pair is used each time if empty.
+ * @param passphrase - The passphrase for the keystore, which must not be empty if keystorePath is set.
+ */
+func runTcpMiner(name string, connection string, peers []string, blocksPath string, genesisPath string, cfg Cfg, keystorePath string, passphrase string) {
+	// A keystore encrypted with no passphrase would leave the key open to anyone who can read the file.
+	if keystorePath != "" && passphrase == "" {
+		fmt.Printf("%v needs a passphrase for keystore %v; set $%v\n", name, keystorePath, PASSPHRASE_ENV)
+		return
+	}
+
+	bc, g, err := LoadGenesis(genesisPath)
+	if errors.Is(err, os.ErrNotExist) {
+		bc, g, err = createGenesis(genesisPath, cfg)
+	}
+	if err != nil {
+		fmt.Printf("%v could not load genesis file %v: %v\n", name, genesisPath, err)
+		return
+	}
+	fmt.Printf("%v is on chain %v\n", name, bc.chainId)
+
+	var store BlockStore = NewMemoryBlockStore()
+	if blocksPath != "" {
+		fileStore, err := NewFileBlockStore(blocksPath, bc)
+		if err != nil {
+			fmt.Printf("%v could not open %v: %v\n", name, blocksPath, err)
+			return
+		}
+		defer fileStore.close()
+		store = fileStore
+	}
+
+	var key *utils.PrivateKey
+	if keystorePath != "" {
+		key, err = utils.ReadKeystore(keystorePath, passphrase)
+		if errors.Is(err, os.ErrNotExist) {
+			key = utils.GenerateKeypair()
+			err = utils.WriteKeystore(keystorePath, key, passphrase)
+		}
+		if err != nil {
+			fmt.Printf("%v could not use keystore %v: %v\n", name, keystorePath, err)
+			return
+		}
+	}
+
+	tm, err := NewTcpMiner(name, connection, bc, g, store, key)
+	if err != nil {
+		fmt.Printf("%v could not use %v: %v\n", name, blocksPath, err)
+		return
+	}
+	fmt.Printf("%v mines to address %v\n", name, tm.MClient.address)
+	if err := tm.start(peers); err != nil {
+		fmt.Printf("%v could not listen on %v: %v\n", name, connection, err)
+		return
+	}
+
+	for {
+		time.Sleep(10 * time.Second)
+		// Read on the miner's own goroutine, between the blocks it handles.
+		tm.MClient.enqueue(func() {
+			fmt.Printf("%v has a chain of length %v and %v gold.\n", name, tm.MClient.lastBlock.ChainLength, tm.MClient.lastBlock.balanceOf(tm.MClient.address))
+		})
+	}
 }
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"testing"
+	"time"
+)
+
+func TestReceiveMessageDropsOtherChains(t *testing.T) {
+	bc := testBlockChain(t)
+	g := fundedGenesis(t, bc)
+	net := NewTcpNet("localhost:0", bc)
+	c := NewClient("C", net, bc, g)
+	net.register([]*Client{c})
+	received := recordTransactions(c)
+
+	key := utils.GenerateKeypair()
+	message := func(chainId string, nonce int) tcpMessage {
+		data, err := encodePayload(signedPayment(key, nonce, "payee", 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tcpMessage{chainId, POST_TRANSACTION, data}
+	}
+
+	net.receiveMessage(message("another chain", 0))
+	expectNoTransaction(t, received, 100*time.Millisecond)
+
+	net.receiveMessage(message(bc.chainId, 1))
+	if tx := nextTransaction(t, received, time.Second); tx.nonce != 1 {
+		t.Fatalf("received the payment with nonce %v, want 1", tx.nonce)
+	}
+}
@@ -2,57 +2,63 @@ package main
 
 import (
 	"SpartanGold/utils"
-	"crypto/rsa"
+	"encoding/hex"
 	"encoding/json"
 )
 
 type Transaction struct {
 	from    string
 	nonce   int
-	pubKey  *rsa.PublicKey
+	pubKey  *utils.PublicKey
 	sig     []byte
 	outputs map[string]int
 	fee     int
 	data    string
 }
 
-func NewTransaction(from string, nonce int, pubKey *rsa.PublicKey, sig []byte, fee int, outputs map[string]int, data string) *Transaction {
+func NewTransaction(from string, nonce int, pubKey *utils.PublicKey, sig []byte, fee int, outputs map[string]int, data string) *Transaction {
 	tx := Transaction{from, nonce, pubKey, sig, outputs, fee, data}
 	return &tx
 }
 
 /**
- * A transaction's ID is derived from its contents.
+ * Creates the coinbase transaction for a block, which pays the miner.
+ * It has no sender, public key or signature.  Its nonce is the height
+ * of the block, so that coinbase transactions in different blocks have
+ * different IDs.
+ *
+ * @param rewardAddr - The address of the miner.
+ * @param chainLength - The height of the block.
+ * @param amount - The coinbase reward, to which the block's fees are added.
  */
-func (t Transaction) getId() string {
-
-	//create new obj with only needed properties
-	//reference stringify -> Marshal https://go.dev/play/p/PWd9fpWrKZH
+func newCoinbaseTransaction(rewardAddr string, chainLength int, amount int) *Transaction {
+	return NewTransaction("", chainLength, nil, nil, 0, map[string]int{rewardAddr: amount}, "")
+}
 
-	var obj struct {
-		from    string
-		nonce   int
-		pubKey  *rsa.PublicKey
-		outputs map[string]int
-		fee     int
-		data    string
-	}
-	obj.from = t.from
-	obj.nonce = t.nonce
-	obj.pubKey = t.pubKey
-	obj.outputs = t.outputs
-	obj.fee = t.fee
-	obj.data = t.data
+/**
+ * Determines whether this is a coinbase transaction, which has no sender.
+ */
+func (t Transaction) isCoinbase() bool {
+	return t.from == ""
+}
 
-	//jsonM := json.Marshal(&obj)
+/**
+ * A transaction's ID is derived from its contents: the sender, nonce,
+ * public key, outputs, fee and data.  The fields are written in a fixed
+ * order and the outputs are sorted by address, so the same transaction
+ * has the same ID on every node.  The signature is left out, since it is
+ * computed over the ID.
+ */
+func (t Transaction) getId() string {
+	obj := t.toJsonObj()
+	obj.Sig = nil
 
 	out, err := json.Marshal(&obj)
 	if err != nil {
 		panic(err)
 	}
 
-	//fmt.Printf("TRANSACTION ID: %v \n", string(utils.Hash("TX"+string(out))))
-	return string(utils.Hash("TX" + string(out)))
+	return hex.EncodeToString(utils.Hash("TX" + string(out)))
 }
 
 /**
@@ -61,7 +67,7 @@ func (t Transaction) getId() string {
  * @param privKey  - The key used to sign the signature.  It should match the
  *    public key included in the transaction.
  */
-func (t *Transaction) sign(priveKey *rsa.PrivateKey) {
+func (t *Transaction) sign(priveKey *utils.PrivateKey) {
 	t.sig = utils.Sign(priveKey, t.getId())
 }
 
@@ -100,3 +106,59 @@ func (t Transaction) totalOutput() int {
 	//including the transaction fee.
 	return total + t.fee
 }
+
+/**
+ * The JSON wire form of a transaction.  Unlike Transaction, every field is
+ * exported so that encoding/json can see it.  The public key is written as
+ * its scheme and base64-encoded key, and the signature is base64-encoded.
+ */
+type txJson struct {
+	From    string         `json:"from"`
+	Nonce   int            `json:"nonce"`
+	PubKey  string         `json:"pubKey"`
+	Sig     []byte         `json:"sig,omitempty"`
+	Outputs map[string]int `json:"outputs"`
+	Fee     int            `json:"fee"`
+	Data    string         `json:"data"`
+}
+
+/**
+ * Copies the transaction into its JSON form.
+ */
+func (t Transaction) toJsonObj() txJson {
+	pubKey := ""
+	if t.pubKey != nil {
+		pubKey = t.pubKey.String()
+	}
+	return txJson{t.from, t.nonce, pubKey, t.sig, t.outputs, t.fee, t.data}
+}
+
+/**
+ * Encodes the transaction, including its signature, for sending over the network.
+ */
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.toJsonObj())
+}
+
+/**
+ * Restores a transaction encoded by MarshalJSON.  The signature is kept as-is,
+ * so validSignature can be used to check that the transaction was not altered.
+ */
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	var o txJson
+	if err := json.Unmarshal(data, &o); err != nil {
+		return err
+	}
+
+	var pubKey *utils.PublicKey
+	if o.PubKey != "" {
+		key, err := utils.ParsePublicKey(o.PubKey)
+		if err != nil {
+			return err
+		}
+		pubKey = key
+	}
+
+	*t = *NewTransaction(o.From, o.Nonce, pubKey, o.Sig, o.Fee, o.Outputs, o.Data)
+	return nil
+}
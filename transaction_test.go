@@ -0,0 +1,59 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestDifferentPaymentsHaveDifferentIdsAndSignatures(t *testing.T) {
+	key := utils.GenerateKeypair()
+	payments := []*Transaction{
+		signedPayment(key, 0, "alice", 10),
+		signedPayment(key, 0, "alice", 11),
+		signedPayment(key, 0, "bob", 10),
+		signedPayment(key, 1, "alice", 10),
+	}
+
+	for i, a := range payments {
+		if !a.validSignature() {
+			t.Fatalf("payment %v does not have a valid signature", i)
+		}
+		for j, b := range payments[:i] {
+			if a.getId() == b.getId() {
+				t.Fatalf("payments %v and %v have the same ID %v", j, i, a.getId())
+			}
+			if bytes.Equal(a.sig, b.sig) {
+				t.Fatalf("payments %v and %v have the same signature", j, i)
+			}
+		}
+	}
+}
+
+func TestTransactionIdSurvivesTheNetwork(t *testing.T) {
+	key := utils.GenerateKeypair()
+	tx := NewTransaction(utils.CalcAddress(key.Public()), 3, key.Public(), nil, 2, map[string]int{"carol": 5, "alice": 7, "bob": 1}, "note")
+	tx.sign(key)
+
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := makeTransaction(data)
+	if received == nil {
+		t.Fatal("could not decode transaction")
+	}
+	if received.getId() != tx.getId() {
+		t.Fatalf("ID changed from %v to %v", tx.getId(), received.getId())
+	}
+	if !received.validSignature() {
+		t.Fatal("received transaction does not have a valid signature")
+	}
+
+	// Changing any part of a signed transaction must break its signature.
+	received.outputs["alice"]++
+	if received.validSignature() {
+		t.Fatal("altered transaction still has a valid signature")
+	}
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Addresses are written in Base58Check: a version byte, the first
+// ADDRESS_HASH_SIZE bytes of the hash of the public key, and a 4-byte
+// checksum, encoded in base 58.  Version 0x3f makes every address start with 'S'.
+const ADDRESS_VERSION byte = 0x3f
+
+const ADDRESS_HASH_SIZE = 20
+
+const ADDRESS_CHECKSUM_SIZE = 4
+
+const BASE58_ALPHABET = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var ErrInvalidAddress = errors.New("invalid address")
+
+func CalcAddress(pubKey *PublicKey) string {
+	payload := append([]byte{ADDRESS_VERSION}, Hash(pubKey.String())[:ADDRESS_HASH_SIZE]...)
+	return base58Encode(append(payload, addressChecksum(payload)...))
+}
+
+func AddressMatchesKey(addr string, pubKey *PublicKey) bool {
+	return pubKey != nil && addr == CalcAddress(pubKey)
+}
+
+// Checks that an address is well formed, so that gold is not sent
+// to a mistyped address that nobody holds the key for.
+func ValidateAddress(addr string) error {
+	data, err := base58Decode(addr)
+	if err != nil {
+		return fmt.Errorf("%w %q: %v", ErrInvalidAddress, addr, err)
+	}
+	if len(data) != 1+ADDRESS_HASH_SIZE+ADDRESS_CHECKSUM_SIZE {
+		return fmt.Errorf("%w %q: wrong length", ErrInvalidAddress, addr)
+	}
+	payload, checksum := data[:len(data)-ADDRESS_CHECKSUM_SIZE], data[len(data)-ADDRESS_CHECKSUM_SIZE:]
+	if !bytes.Equal(checksum, addressChecksum(payload)) {
+		return fmt.Errorf("%w %q: checksum does not match", ErrInvalidAddress, addr)
+	}
+	if payload[0] != ADDRESS_VERSION {
+		return fmt.Errorf("%w %q: unknown version %d", ErrInvalidAddress, addr, payload[0])
+	}
+	return nil
+}
+
+func addressChecksum(payload []byte) []byte {
+	return Hash(string(Hash(string(payload))))[:ADDRESS_CHECKSUM_SIZE]
+}
+
+func base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	base, mod := big.NewInt(58), new(big.Int)
+	out := []byte{}
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, BASE58_ALPHABET[mod.Int64()])
+	}
+	// Each leading zero byte is written as the first character.
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, BASE58_ALPHABET[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	n, base := new(big.Int), big.NewInt(58)
+	zeroes := 0
+	for i, c := range s {
+		digit := strings.IndexRune(BASE58_ALPHABET, c)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid character %q", c)
+		}
+		if digit == 0 && i == zeroes {
+			zeroes++
+		}
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+	return append(make([]byte, zeroes), n.Bytes()...), nil
+}
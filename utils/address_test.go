@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateAddressAcceptsCalculatedAddresses(t *testing.T) {
+	for _, scheme := range allSchemes {
+		key, err := GenerateKeypairWith(scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := CalcAddress(key.Public())
+		if err := ValidateAddress(addr); err != nil {
+			t.Fatalf("address %v of a %v key refused: %v", addr, scheme, err)
+		}
+		if !strings.HasPrefix(addr, "S") {
+			t.Fatalf("address %v does not start with 'S'", addr)
+		}
+	}
+}
+
+func TestValidateAddressRefusesOneCharacterTypo(t *testing.T) {
+	addr := CalcAddress(GenerateKeypair().Public())
+	for i := range addr {
+		// Replacing the character with the next one in the alphabet.
+		next := BASE58_ALPHABET[(strings.IndexByte(BASE58_ALPHABET, addr[i])+1)%len(BASE58_ALPHABET)]
+		typo := addr[:i] + string(next) + addr[i+1:]
+		if err := ValidateAddress(typo); !errors.Is(err, ErrInvalidAddress) {
+			t.Fatalf("typo %v of %v at position %v: got %v, want ErrInvalidAddress", typo, addr, i, err)
+		}
+	}
+}
+
+func TestValidateAddressRefusesMalformedAddresses(t *testing.T) {
+	// An address with a valid checksum, but for a version that is not used.
+	payload := append([]byte{ADDRESS_VERSION + 1}, Hash("key")[:ADDRESS_HASH_SIZE]...)
+	otherVersion := base58Encode(append(payload, addressChecksum(payload)...))
+
+	addr := CalcAddress(GenerateKeypair().Public())
+	tests := []struct {
+		name string
+		addr string
+	}{
+		{"empty", ""},
+		{"unknown version", otherVersion},
+		{"character not in the alphabet", "0" + addr[1:]},
+		{"too short", addr[:len(addr)-1]},
+		{"too long", addr + "1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateAddress(test.addr); !errors.Is(err, ErrInvalidAddress) {
+				t.Fatalf("got %v, want ErrInvalidAddress", err)
+			}
+		})
+	}
+}
+
+func TestBase58KeepsLeadingZeroes(t *testing.T) {
+	data := []byte{0, 0, 1, 2, 255}
+	decoded, err := base58Decode(base58Encode(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded) != string(data) {
+		t.Fatalf("decoded %v, want %v", decoded, data)
+	}
+}
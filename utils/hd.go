@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Bits of entropy in a new mnemonic, which makes it 24 words long.
+const MNEMONIC_ENTROPY_BITS = 256
+
+// Keys are derived as in SLIP-0010, the Ed25519 version of BIP-32.
+// Ed25519 only supports hardened derivation, so every index is hardened.
+const HARDENED_OFFSET uint32 = 0x80000000
+
+const SLIP10_ED25519_CURVE = "ed25519 seed"
+
+// The path to the account that wallet addresses are derived under,
+// m/44'/7777'/0'/0', following BIP-44.  7777 is not a registered coin type.
+var WALLET_ACCOUNT_PATH = []uint32{44, 7777, 0, 0}
+
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// A key in a tree of keys derived from one seed.  Knowing a key and its
+// chain code is enough to derive every key below it.
+type ExtendedKey struct {
+	key       []byte
+	chainCode []byte
+}
+
+// Returns a new random mnemonic.  Anyone with the mnemonic can spend
+// the gold held by every address derived from it.
+func NewMnemonic() string {
+	entropy, err := bip39.NewEntropy(MNEMONIC_ENTROPY_BITS)
+	if err != nil {
+		panic(err)
+	}
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		panic(err)
+	}
+	return mnemonic
+}
+
+// Returns the root of the key tree for the mnemonic.  The passphrase is
+// optional, but the same one must be used to recover the same keys.
+func MasterKeyFromMnemonic(mnemonic string, passphrase string) (*ExtendedKey, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, ErrInvalidMnemonic
+	}
+	return masterKey(seed), nil
+}
+
+func masterKey(seed []byte) *ExtendedKey {
+	h := hmac.New(sha512.New, []byte(SLIP10_ED25519_CURVE))
+	h.Write(seed)
+	sum := h.Sum(nil)
+	return &ExtendedKey{sum[:32], sum[32:]}
+}
+
+// Returns the hardened child key with the specified index.
+func (k *ExtendedKey) Child(index uint32) *ExtendedKey {
+	var i [4]byte
+	binary.BigEndian.PutUint32(i[:], index|HARDENED_OFFSET)
+	data := make([]byte, 0, 1+len(k.key)+len(i))
+	data = append(data, 0)
+	data = append(data, k.key...)
+	data = append(data, i[:]...)
+
+	h := hmac.New(sha512.New, k.chainCode)
+	h.Write(data)
+	sum := h.Sum(nil)
+	return &ExtendedKey{sum[:32], sum[32:]}
+}
+
+// Follows a path of hardened indexes down from this key.
+func (k *ExtendedKey) Derive(path []uint32) *ExtendedKey {
+	for _, index := range path {
+		k = k.Child(index)
+	}
+	return k
+}
+
+// Returns the Ed25519 key pair for this key.
+func (k *ExtendedKey) PrivateKey() *PrivateKey {
+	return &PrivateKey{ED25519, ed25519.NewKeyFromSeed(k.key)}
+}
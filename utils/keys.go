@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	b64 "encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A signature scheme.  Every public key is tagged with the scheme it is
+// for, so that keys of different schemes can be used on the same chain.
+type Scheme string
+
+const (
+	ED25519    Scheme = "ed25519"
+	ECDSA_P256 Scheme = "ecdsa-p256"
+	// Kept so that RSA keys can still be used; new keys should not use it.
+	RSA Scheme = "rsa"
+)
+
+// The scheme used by GenerateKeypair.
+const DEFAULT_SCHEME = ED25519
+
+// Size of keys made for the legacy RSA scheme.
+const RSA_KEY_BITS = 2048
+
+var ErrUnknownScheme = errors.New("unknown signature scheme")
+
+// A public key along with the scheme it is for.  Key holds the raw
+// Ed25519 key, the compressed P-256 point, or the PKIX encoding of an RSA key.
+type PublicKey struct {
+	Scheme Scheme
+	Key    []byte
+}
+
+type PrivateKey struct {
+	Scheme Scheme
+	signer crypto.Signer
+}
+
+func GenerateKeypair() *PrivateKey {
+	key, err := GenerateKeypairWith(DEFAULT_SCHEME)
+	if err != nil {
+		fmt.Println("Error generating key")
+		panic(err)
+	}
+	return key
+}
+
+func GenerateKeypairWith(scheme Scheme) (*PrivateKey, error) {
+	var signer crypto.Signer
+	var err error
+	switch scheme {
+	case ED25519:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	case ECDSA_P256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case RSA:
+		signer, err = rsa.GenerateKey(rand.Reader, RSA_KEY_BITS)
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownScheme, scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{scheme, signer}, nil
+}
+
+func (k *PrivateKey) Public() *PublicKey {
+	switch pub := k.signer.Public().(type) {
+	case ed25519.PublicKey:
+		return &PublicKey{k.Scheme, []byte(pub)}
+	case *ecdsa.PublicKey:
+		return &PublicKey{k.Scheme, elliptic.MarshalCompressed(pub.Curve, pub.X, pub.Y)}
+	default:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			panic(err)
+		}
+		return &PublicKey{k.Scheme, der}
+	}
+}
+
+func Sign(privKey *PrivateKey, msg string) []byte {
+	var sig []byte
+	var err error
+	switch key := privKey.signer.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, []byte(msg))
+	case *ecdsa.PrivateKey:
+		sig, err = ecdsa.SignASN1(rand.Reader, key, Hash(msg))
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, Hash(msg))
+	}
+	if err != nil {
+		fmt.Println("Error signing")
+		panic(err)
+	}
+	return sig
+}
+
+func VerifySignature(pubKey *PublicKey, msg string, sig []byte) bool {
+	if pubKey == nil {
+		return false
+	}
+	switch pubKey.Scheme {
+	case ED25519:
+		if len(pubKey.Key) != ed25519.PublicKeySize {
+			return false
+		}
+		return ed25519.Verify(ed25519.PublicKey(pubKey.Key), []byte(msg), sig)
+	case ECDSA_P256:
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), pubKey.Key)
+		if x == nil {
+			return false
+		}
+		return ecdsa.VerifyASN1(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, Hash(msg), sig)
+	case RSA:
+		key, err := x509.ParsePKIXPublicKey(pubKey.Key)
+		if err != nil {
+			return false
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, Hash(msg), sig) == nil
+	}
+	return false
+}
+
+// Returns the key as its scheme, a colon, and the base64 encoding of the key.
+func (k PublicKey) String() string {
+	return string(k.Scheme) + ":" + b64.StdEncoding.EncodeToString(k.Key)
+}
+
+// Restores a public key written by PublicKey.String.
+func ParsePublicKey(s string) (*PublicKey, error) {
+	scheme, encoded, found := strings.Cut(s, ":")
+	if !found {
+		return nil, errors.New("public key is missing its scheme")
+	}
+	switch Scheme(scheme) {
+	case ED25519, ECDSA_P256, RSA:
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownScheme, scheme)
+	}
+	key, err := b64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicKey{Scheme(scheme), key}, nil
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+var allSchemes = []Scheme{ED25519, ECDSA_P256, RSA}
+
+func TestSignAndVerifyWithEachScheme(t *testing.T) {
+	const MSG = "pay alice 10 gold"
+	for _, scheme := range allSchemes {
+		t.Run(string(scheme), func(t *testing.T) {
+			key, err := GenerateKeypairWith(scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := GenerateKeypairWith(scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig := Sign(key, MSG)
+
+			if !VerifySignature(key.Public(), MSG, sig) {
+				t.Fatal("valid signature refused")
+			}
+			if VerifySignature(key.Public(), MSG+".", sig) {
+				t.Fatal("signature accepted for another message")
+			}
+			if VerifySignature(other.Public(), MSG, sig) {
+				t.Fatal("signature accepted for another key")
+			}
+			altered := append([]byte{}, sig...)
+			altered[len(altered)/2] ^= 1
+			if VerifySignature(key.Public(), MSG, altered) {
+				t.Fatal("altered signature accepted")
+			}
+
+			// A key read back from its string form verifies the same signature.
+			parsed, err := ParsePublicKey(key.Public().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.String() != key.Public().String() {
+				t.Fatalf("parsed key is %v, want %v", parsed, key.Public())
+			}
+			if !VerifySignature(parsed, MSG, sig) {
+				t.Fatal("parsed key refused a valid signature")
+			}
+
+			// The key must be used with the scheme it was made for.
+			for _, wrong := range allSchemes {
+				if wrong != scheme && VerifySignature(&PublicKey{wrong, parsed.Key}, MSG, sig) {
+					t.Fatalf("signature accepted with the key tagged as %v", wrong)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePublicKeyRefusesMalformedKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"no scheme", "AAAA"},
+		{"unknown scheme", "dsa:AAAA"},
+		{"invalid base64", "ed25519:not base64!"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if key, err := ParsePublicKey(test.key); err == nil {
+				t.Fatalf("parsed %q as %v", test.key, key)
+			}
+		})
+	}
+
+	if _, err := ParsePublicKey("dsa:AAAA"); !errors.Is(err, ErrUnknownScheme) {
+		t.Fatalf("got %v, want ErrUnknownScheme", err)
+	}
+	if _, err := GenerateKeypairWith("dsa"); !errors.Is(err, ErrUnknownScheme) {
+		t.Fatalf("got %v, want ErrUnknownScheme", err)
+	}
+}
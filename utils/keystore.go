@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Version of the keystore file format.
+const KEYSTORE_VERSION = 1
+
+// Cost parameters for deriving the encryption key from a passphrase.
+// N = 2^15 takes roughly 100ms and 32MB, which is slow enough to make
+// guessing passphrases expensive.
+const SCRYPT_N = 1 << 15
+
+const SCRYPT_R = 8
+
+const SCRYPT_P = 1
+
+const KEYSTORE_SALT_SIZE = 16
+
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted keystore")
+
+type scryptParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+}
+
+// A private key as it is written to disk.  The key is encrypted with
+// AES-256-GCM, using a key derived from the passphrase with scrypt.  The
+// address and scheme are not secret, but are authenticated along with
+// the key, so they cannot be changed without the passphrase.
+type keystoreJson struct {
+	Version    int          `json:"version"`
+	Address    string       `json:"address"`
+	Scheme     Scheme       `json:"scheme"`
+	Kdf        string       `json:"kdf"`
+	KdfParams  scryptParams `json:"kdfParams"`
+	Nonce      []byte       `json:"nonce"`
+	Ciphertext []byte       `json:"ciphertext"`
+}
+
+// Encrypts the private key with the passphrase.
+func EncryptKey(key *PrivateKey, passphrase string) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key.signer)
+	if err != nil {
+		return nil, err
+	}
+
+	o := keystoreJson{Version: KEYSTORE_VERSION, Address: CalcAddress(key.Public()), Scheme: key.Scheme, Kdf: "scrypt"}
+	o.KdfParams = scryptParams{SCRYPT_N, SCRYPT_R, SCRYPT_P, make([]byte, KEYSTORE_SALT_SIZE)}
+	if _, err := rand.Read(o.KdfParams.Salt); err != nil {
+		return nil, err
+	}
+	aead, err := keystoreCipher(passphrase, o.KdfParams)
+	if err != nil {
+		return nil, err
+	}
+	o.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(o.Nonce); err != nil {
+		return nil, err
+	}
+	o.Ciphertext = aead.Seal(nil, o.Nonce, der, o.additionalData())
+	return json.MarshalIndent(o, "", "  ")
+}
+
+// Decrypts a private key encrypted by EncryptKey.
+func DecryptKey(data []byte, passphrase string) (*PrivateKey, error) {
+	var o keystoreJson
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, err
+	}
+	if o.Version != KEYSTORE_VERSION || o.Kdf != "scrypt" {
+		return nil, fmt.Errorf("unsupported keystore version %v with kdf %q", o.Version, o.Kdf)
+	}
+	aead, err := keystoreCipher(passphrase, o.KdfParams)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.Nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	der, err := aead.Open(nil, o.Nonce, o.Ciphertext, o.additionalData())
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	var signer crypto.Signer
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		signer = k
+	case *ecdsa.PrivateKey:
+		signer = k
+	case *rsa.PrivateKey:
+		signer = k
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnknownScheme, parsed)
+	}
+	key := &PrivateKey{o.Scheme, signer}
+	if CalcAddress(key.Public()) != o.Address {
+		return nil, fmt.Errorf("keystore key does not match address %v", o.Address)
+	}
+	return key, nil
+}
+
+// Encrypts the private key and writes it to a file that only the user can read.
+func WriteKeystore(path string, key *PrivateKey, passphrase string) error {
+	data, err := EncryptKey(key, passphrase)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// Reads a private key written by WriteKeystore.
+func ReadKeystore(path string, passphrase string) (*PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptKey(data, passphrase)
+}
+
+func keystoreCipher(passphrase string, params scryptParams) (cipher.AEAD, error) {
+	secret, err := scrypt.Key([]byte(passphrase), params.Salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (o keystoreJson) additionalData() []byte {
+	return []byte(o.Address + ":" + string(o.Scheme))
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	for _, scheme := range allSchemes {
+		t.Run(string(scheme), func(t *testing.T) {
+			key, err := GenerateKeypairWith(scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(t.TempDir(), "keystore.json")
+			if err := WriteKeystore(path, key, "passphrase"); err != nil {
+				t.Fatal(err)
+			}
+			if info, err := os.Stat(path); err != nil {
+				t.Fatal(err)
+			} else if mode := info.Mode().Perm(); mode != 0600 {
+				t.Fatalf("keystore has mode %v, want -rw-------", mode)
+			}
+
+			restored, err := ReadKeystore(path, "passphrase")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored.Scheme != scheme {
+				t.Fatalf("restored a %v key, want %v", restored.Scheme, scheme)
+			}
+			if CalcAddress(restored.Public()) != CalcAddress(key.Public()) {
+				t.Fatal("restored key has a different address")
+			}
+			if !VerifySignature(key.Public(), "msg", Sign(restored, "msg")) {
+				t.Fatal("restored key does not sign for the original public key")
+			}
+		})
+	}
+}
+
+func TestKeystoreRefusesWrongPassphrase(t *testing.T) {
+	key := GenerateKeypair()
+	data, err := EncryptKey(key, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, passphrase := range []string{"Passphrase", "passphrase ", ""} {
+		if _, err := DecryptKey(data, passphrase); !errors.Is(err, ErrWrongPassphrase) {
+			t.Fatalf("passphrase %q: got %v, want ErrWrongPassphrase", passphrase, err)
+		}
+	}
+
+	// The address is authenticated, so it cannot be swapped for another.
+	var o keystoreJson
+	if err := json.Unmarshal(data, &o); err != nil {
+		t.Fatal(err)
+	}
+	o.Address = CalcAddress(GenerateKeypair().Public())
+	if data, err = json.Marshal(o); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptKey(data, "passphrase"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("changed address: got %v, want ErrWrongPassphrase", err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"fmt"
+	"sort"
+)
+
+// When recovering a wallet, addresses are derived until this many in a row
+// have never been used, on the assumption that no later address was used either.
+const WALLET_GAP_LIMIT = 20
+
+/**
+ * A wallet holds many addresses, all derived from one mnemonic seed phrase,
+ * so that writing down the seed phrase is enough to back up every address.
+ * Its client follows the blockchain and uses the wallet's first address.
+ */
+type Wallet struct {
+	Client    *Client
+	mnemonic  string
+	account   *utils.ExtendedKey
+	addresses []string
+	keys      map[string]*utils.PrivateKey
+	// The next nonce to use for each address.
+	nonces map[string]int
+	// Transactions posted by the wallet that have not been confirmed yet.
+	pendingTransactions map[string]*Transaction
+}
+
+/**
+ * Creates a wallet with a new seed phrase.
+ *
+ * @param name - The name of the wallet's client.
+ * @param net - The network the client uses.
+ * @param bc - The blockchain settings.
+ * @param startingBlock - The genesis block of the blockchain.
+ */
+func NewWallet(name string, net Network, bc *BlockChain, startingBlock *Block) *Wallet {
+	w, err := RestoreWallet(name, net, bc, startingBlock, utils.NewMnemonic(), "")
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
+/**
+ * Recovers a wallet from its seed phrase.  Addresses are derived in the same
+ * order as when the wallet was created, until WALLET_GAP_LIMIT unused addresses
+ * in a row are found.  A wallet restored before its client has the blockchain
+ * should call discoverAddresses once it does.
+ *
+ * @param mnemonic - The seed phrase of the wallet.
+ * @param passphrase - The passphrase the wallet was created with, if any.
+ *
+ * @returns {Wallet} - The wallet, or utils.ErrInvalidMnemonic if the seed
+ *    phrase is misspelled or its checksum does not match.
+ */
+func RestoreWallet(name string, net Network, bc *BlockChain, startingBlock *Block, mnemonic string, passphrase string) (*Wallet, error) {
+	master, err := utils.MasterKeyFromMnemonic(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var w Wallet
+	w.mnemonic = mnemonic
+	w.account = master.Derive(utils.WALLET_ACCOUNT_PATH)
+	w.addresses = []string{}
+	w.keys = make(map[string]*utils.PrivateKey)
+	w.nonces = make(map[string]int)
+	w.pendingTransactions = make(map[string]*Transaction)
+
+	// An empty store is never refused.
+	w.Client, _ = NewClientWithStore(name, net, bc, startingBlock, NewMemoryBlockStore(), w.account.Child(0).PrivateKey())
+	w.newAddress()
+	w.discoverAddresses()
+	return &w, nil
+}
+
+/**
+ * Returns the wallet's seed phrase, which should be written down and kept secret.
+ */
+func (w *Wallet) Mnemonic() string {
+	return w.mnemonic
+}
+
+/**
+ * Derives the next address of the wallet.  Using a new address for each
+ * payment received makes it harder to link the payments together.
+ *
+ * @returns {String} - The new address.
+ */
+func (w *Wallet) newAddress() string {
+	key := w.account.Child(uint32(len(w.addresses))).PrivateKey()
+	address := utils.CalcAddress(key.Public())
+	w.addresses = append(w.addresses, address)
+	w.keys[address] = key
+	return address
+}
+
+/**
+ * Derives addresses until the last WALLET_GAP_LIMIT of them have never
+ * been used on the client's current chain.
+ */
+func (w *Wallet) discoverAddresses() {
+	unused := 0
+	for i := len(w.addresses) - 1; i >= 0 && !w.isUsed(w.addresses[i]); i-- {
+		unused++
+	}
+	for unused < WALLET_GAP_LIMIT {
+		if w.isUsed(w.newAddress()) {
+			unused = 0
+		} else {
+			unused++
+		}
+	}
+}
+
+/**
+ * Determines whether an address has received or sent gold on the current chain.
+ */
+func (w *Wallet) isUsed(address string) bool {
+	block := w.Client.lastBlock
+	if block == nil {
+		return false
+	}
+	_, received := block.Balances[address]
+	return received || block.NextNonce[address] > 0
+}
+
+/**
+ * Returns the addresses of the wallet, in the order they were derived.
+ */
+func (w *Wallet) getAddresses() []string {
+	return append([]string{}, w.addresses...)
+}
+
+/**
+ * The confirmed gold held by all of the wallet's addresses together.
+ */
+func (w *Wallet) getConfirmedBalance() int {
+	total := 0
+	for _, address := range w.addresses {
+		total += w.Client.lastConfirmedBlock.balanceOf(address)
+	}
+	return total
+}
+
+/**
+ * The gold that the wallet can spend: the confirmed gold of all of its
+ * addresses, less any gold given away in unconfirmed transactions.
+ */
+func (w *Wallet) getAvailableGold() int {
+	total := 0
+	for _, address := range w.addresses {
+		total += w.availableGoldOf(address)
+	}
+	return total
+}
+
+/**
+ * The gold that one of the wallet's addresses can spend.  Pending
+ * transactions that have been confirmed are forgotten along the way.
+ */
+func (w *Wallet) availableGoldOf(address string) int {
+	confirmed := w.Client.lastConfirmedBlock
+	available := confirmed.balanceOf(address)
+	for id, tx := range w.pendingTransactions {
+		if tx.from != address {
+			continue
+		}
+		if tx.nonce < confirmed.NextNonce[address] {
+			delete(w.pendingTransactions, id)
+		} else {
+			available -= tx.totalOutput()
+		}
+	}
+	return available
+}
+
+/**
+ * Pays the specified outputs from whichever of the wallet's addresses hold
+ * gold, richest first.  Each address used sends its own transaction, paying
+ * its own fee, so paying from several addresses costs more in fees.
+ *
+ * @param outputs - The amount to pay to each address.
+ * @param fee - The fee for each transaction, if more than the default.
+ *
+ * @returns {Array} - The posted transactions.  If any output address is
+ *    malformed, or the wallet does not have enough available gold, nothing
+ *    is posted and ErrInvalidAddress or ErrInsufficientFunds is returned.
+ */
+func (w *Wallet) postTransaction(outputs map[string]int, fee int) ([]*Transaction, error) {
+	f := w.Client.blockChain.cfg.defaultTxFee
+	if fee > f {
+		f = fee
+	}
+
+	recipients := make([]string, 0, len(outputs))
+	remaining := make(map[string]int)
+	for address, amount := range outputs {
+		if err := utils.ValidateAddress(address); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, address)
+		remaining[address] = amount
+	}
+	sort.Strings(recipients)
+
+	available := make(map[string]int)
+	senders := []string{}
+	for _, address := range w.addresses {
+		if gold := w.availableGoldOf(address); gold > f {
+			available[address] = gold
+			senders = append(senders, address)
+		}
+	}
+	sort.SliceStable(senders, func(i, j int) bool { return available[senders[i]] > available[senders[j]] })
+
+	// Deciding how much each address pays before signing anything, so that
+	// nothing is posted if the wallet cannot pay the whole amount.
+	plan := make(map[string]map[string]int)
+	order := []string{}
+	for _, sender := range senders {
+		budget := available[sender] - f
+		txOutputs := make(map[string]int)
+		for _, recipient := range recipients {
+			amount := remaining[recipient]
+			if amount > budget {
+				amount = budget
+			}
+			if amount > 0 {
+				txOutputs[recipient] = amount
+				remaining[recipient] -= amount
+				budget -= amount
+			}
+		}
+		if len(txOutputs) > 0 {
+			plan[sender] = txOutputs
+			order = append(order, sender)
+		}
+	}
+	for _, amount := range remaining {
+		if amount > 0 {
+			return nil, fmt.Errorf("%w: the wallet only has %v available", ErrInsufficientFunds, w.getAvailableGold())
+		}
+	}
+
+	txs := []*Transaction{}
+	for _, sender := range order {
+		key := w.keys[sender]
+		nonce := w.nonces[sender]
+		if next := w.Client.lastBlock.NextNonce[sender]; next > nonce {
+			nonce = next
+		}
+		tx := NewTransaction(sender, nonce, key.Public(), nil, f, plan[sender], "")
+		tx.sign(key)
+		w.nonces[sender] = nonce + 1
+		w.pendingTransactions[tx.getId()] = tx
+		w.Client.net.broadcast(sender, POST_TRANSACTION, tx)
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
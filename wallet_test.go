@@ -0,0 +1,72 @@
+package main
+
+import (
+	"SpartanGold/utils"
+	"errors"
+	"testing"
+)
+
+func TestRestoredWalletSpendsFromSeveralAddresses(t *testing.T) {
+	bc := testBlockChain(t)
+	mnemonic := utils.NewMnemonic()
+
+	// Deriving the wallet's addresses before the chain exists, so
+	// that the genesis block can give gold to two of them.
+	original, err := RestoreWallet("Original", NewFakeNet(), bc, nil, mnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addresses := original.getAddresses()
+	g, err := bc.makeGenesis(nil, map[string]int{addresses[0]: 50, addresses[3]: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := RestoreWallet("Restored", NewFakeNet(), bc, g, mnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := w.getAddresses()
+	for i := 0; i <= 3; i++ {
+		if restored[i] != addresses[i] {
+			t.Fatalf("address %v is %v after restoring, but was %v", i, restored[i], addresses[i])
+		}
+	}
+	if gold := w.getConfirmedBalance(); gold != 90 {
+		t.Fatalf("restored wallet has %v gold, want 90", gold)
+	}
+
+	m := NewMiner("Miner", NewFakeNet(), bc, g)
+	fee := bc.cfg.defaultTxFee
+	txs, err := w.postTransaction(map[string]int{m.MClient.address: 70}, fee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 2 {
+		t.Fatalf("paid with %v transactions, want one from each funded address", len(txs))
+	}
+	for _, tx := range txs {
+		if !m.addTransaction(tx) {
+			t.Fatalf("miner refused transaction %v", tx.getId())
+		}
+	}
+
+	block := mineBlock(t, m, w.Client)
+	if len(block.Transactions) != 2 {
+		t.Fatalf("block has %v transactions, want 2", len(block.Transactions))
+	}
+	spent := 0
+	for _, address := range w.getAddresses() {
+		spent += g.balanceOf(address) - w.Client.lastBlock.balanceOf(address)
+	}
+	if want := 70 + 2*fee; spent != want {
+		t.Fatalf("wallet spent %v, want %v", spent, want)
+	}
+}
+
+func TestRestoreWalletRefusesInvalidMnemonic(t *testing.T) {
+	_, err := RestoreWallet("W", NewFakeNet(), testBlockChain(t), nil, "not a real seed phrase", "")
+	if !errors.Is(err, utils.ErrInvalidMnemonic) {
+		t.Fatalf("got %v, want ErrInvalidMnemonic", err)
+	}
+}